@@ -0,0 +1,42 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package math provides integer math utilities.
+package math
+
+// MaxUint64 is the largest value representable by a uint64.
+const MaxUint64 = 1<<64 - 1
+
+// SafeAdd returns a + b and whether the addition overflowed a uint64.
+func SafeAdd(a, b uint64) (uint64, bool) {
+	c := a + b
+	return c, c < a
+}
+
+// SafeSub returns a - b and whether the subtraction underflowed a uint64.
+func SafeSub(a, b uint64) (uint64, bool) {
+	c := a - b
+	return c, c > a
+}
+
+// SafeMul returns a * b and whether the multiplication overflowed a uint64.
+func SafeMul(a, b uint64) (uint64, bool) {
+	if a == 0 || b == 0 {
+		return 0, false
+	}
+	c := a * b
+	return c, c/a != b
+}
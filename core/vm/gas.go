@@ -0,0 +1,168 @@
+// Copyright 2014 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/ethereumproject/go-ethereum/common/math"
+)
+
+// ErrGasUintOverflow is returned whenever a gas computation would not fit in
+// a uint64, e.g. when a contract deliberately supplies an absurd memory
+// offset to make the VM's bookkeeping wrap around.
+var ErrGasUintOverflow = errors.New("gas uint64 overflow")
+
+// Gas step costs, shared by the simple fixed-cost opcodes.
+const (
+	GasQuickStep   uint64 = 2
+	GasFastestStep uint64 = 3
+	GasFastStep    uint64 = 5
+	GasMidStep     uint64 = 8
+	GasSlowStep    uint64 = 10
+	GasExtStep     uint64 = 20
+
+	memoryGasPerWord   = 3
+	memoryQuadCoeffDiv = 512
+
+	// Sha3Gas and CreateGas are the flat base costs SHA3 and CREATE/CREATE2
+	// charge on top of their variable, argument-dependent portion.
+	Sha3Gas   uint64 = 30
+	CreateGas uint64 = 32000
+)
+
+// GasTable holds the opcode gas prices that vary across hard forks. It is
+// plain uint64 rather than *big.Int: gas is metered far more often than it
+// is displayed, so keeping it machine-word-sized avoids an allocation on
+// every opcode.
+type GasTable struct {
+	ExtcodeSize uint64
+	ExtcodeCopy uint64
+	Balance     uint64
+	SLoad       uint64
+	Calls       uint64
+	Suicide     uint64
+	ExpByte     uint64
+
+	// CreateBySuicide is non-zero once the Homestead fork is active, when a
+	// SUICIDE that creates a new account (by sending value to one that
+	// doesn't yet exist) is charged the same as CREATE.
+	CreateBySuicide uint64
+}
+
+// toWordSize rounds size up to the nearest multiple of 32, expressed in
+// words rather than bytes.
+func toWordSize(size uint64) uint64 {
+	if size > math.MaxUint64-31 {
+		return math.MaxUint64/32 + 1
+	}
+	return (size + 31) / 32
+}
+
+// calcMemSize returns the highest memory offset (off+length) an opcode
+// touches, given its off and length stack arguments. The second return
+// value reports whether that offset overflows a uint64 -- stack items are
+// full 256-bit words, so a contract can trivially ask for a memory range no
+// real machine could ever back.
+func calcMemSize(off, length *big.Int) (uint64, bool) {
+	if length.Sign() == 0 {
+		return 0, false
+	}
+	if off.BitLen() > 64 || length.BitLen() > 64 {
+		return 0, true
+	}
+
+	sum := new(big.Int).Add(off, length)
+	if sum.BitLen() > 64 {
+		return 0, true
+	}
+	return sum.Uint64(), false
+}
+
+// memoryExpansionFee returns the total (not marginal) gas cost of having
+// memory sized to the given number of words, per the usual
+// words*3 + words*words/512 formula.
+func memoryExpansionFee(words uint64) (uint64, bool) {
+	square, overflow := math.SafeMul(words, words)
+	if overflow {
+		return 0, true
+	}
+	linCoef, overflow := math.SafeMul(words, memoryGasPerWord)
+	if overflow {
+		return 0, true
+	}
+	fee, overflow := math.SafeAdd(linCoef, square/memoryQuadCoeffDiv)
+	if overflow {
+		return 0, true
+	}
+	return fee, false
+}
+
+// memoryGasCost returns the marginal gas cost of growing mem to newMemSize
+// bytes, i.e. the quadratic memory expansion fee minus what was already
+// paid for the memory mem currently has.
+func memoryGasCost(mem *Memory, newMemSize uint64) (uint64, error) {
+	if newMemSize == 0 {
+		return 0, nil
+	}
+
+	newWords := toWordSize(newMemSize)
+	newWordsBytes, overflow := math.SafeMul(newWords, 32)
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+	if newWordsBytes <= uint64(mem.Len()) {
+		return 0, nil
+	}
+
+	newFee, overflow := memoryExpansionFee(newWords)
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+	oldFee, overflow := memoryExpansionFee(toWordSize(uint64(mem.Len())))
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+
+	cost, overflow := math.SafeSub(newFee, oldFee)
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+	return cost, nil
+}
+
+// callGas applies the EIP150 63/64 rule: a CALL-like opcode may only
+// forward all but one 64th of the gas left after paying its own base cost,
+// regardless of how much gas the caller asked to forward. Pre-EIP150 there
+// was no such cap, so it's gated on IsHomestead the same way gasSuicide
+// gates gasTable.CreateBySuicide -- both only apply once the EIP150 GasTable
+// is in effect.
+func callGas(env Environment, gasTable *GasTable, availableGas, base uint64, callCost *big.Int) (uint64, error) {
+	available, overflow := math.SafeSub(availableGas, base)
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+	if env.RuleSet().IsHomestead(env.BlockNumber()) {
+		available -= available / 64
+	}
+
+	if !callCost.IsUint64() || callCost.Uint64() > available {
+		return available, nil
+	}
+	return callCost.Uint64(), nil
+}
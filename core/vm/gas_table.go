@@ -0,0 +1,362 @@
+// Copyright 2014 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/common/math"
+)
+
+// This file holds the gasDynamicFuncs backing every opcode whose price
+// isn't a flat per-category constant. Each one is attached to its opcode's
+// jump table entry via dynamicGasCost (or, for the ones that are EVM
+// methods, by New), and works in uint64 gas rather than
+// *big.Int: gas never exceeds a block's gas limit, which comfortably fits
+// in 64 bits, so there's no reason to allocate a big.Int on every opcode.
+// Overflow is checked explicitly with the common/math Safe* helpers instead.
+
+func gasSuicide(gm *Gasometer, env Environment, contract *Contract, stack *stack, mem *Memory, memorySize uint64) (uint64, error) {
+	var gas uint64
+	if env.RuleSet().IsHomestead(env.BlockNumber()) {
+		gas = gm.gasTable.Suicide
+		if !env.Db().Exist(common.BigToAddress(stack.data[len(stack.data)-1])) {
+			var overflow bool
+			if gas, overflow = math.SafeAdd(gas, gm.gasTable.CreateBySuicide); overflow {
+				return 0, ErrGasUintOverflow
+			}
+		}
+	}
+
+	if !env.Db().HasSuicided(contract.Address()) {
+		env.Db().AddRefund(big.NewInt(24000))
+	}
+	return gas, nil
+}
+
+func gasSLoad(gm *Gasometer, env Environment, contract *Contract, stack *stack, mem *Memory, memorySize uint64) (uint64, error) {
+	return gm.gasTable.SLoad, nil
+}
+
+func gasBalance(gm *Gasometer, env Environment, contract *Contract, stack *stack, mem *Memory, memorySize uint64) (uint64, error) {
+	return gm.gasTable.Balance, nil
+}
+
+func gasExtCodeSize(gm *Gasometer, env Environment, contract *Contract, stack *stack, mem *Memory, memorySize uint64) (uint64, error) {
+	return gm.gasTable.ExtcodeSize, nil
+}
+
+func gasExtCodeCopy(gm *Gasometer, env Environment, contract *Contract, stack *stack, mem *Memory, memorySize uint64) (uint64, error) {
+	return memoryCopierGas(stack.data[stack.len()-4], mem, memorySize, gm.gasTable.ExtcodeCopy)
+}
+
+// gasCopy returns a gasDynamicFunc for the *COPY opcodes that charge a flat
+// per-word fee, on top of the given base step cost, for every word they
+// copy into memory.
+func gasCopy(base uint64) gasDynamicFunc {
+	return func(gm *Gasometer, env Environment, contract *Contract, stack *stack, mem *Memory, memorySize uint64) (uint64, error) {
+		return memoryCopierGas(stack.data[stack.len()-3], mem, memorySize, base)
+	}
+}
+
+// memoryCopierGas computes base + 3 gas per word copied (where the length
+// being copied is the size argument, in words) plus the quadratic memory
+// expansion fee, checking for uint64 overflow throughout.
+func memoryCopierGas(size *big.Int, mem *Memory, memorySize uint64, base uint64) (uint64, error) {
+	words, overflow := bigToWords(size)
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+	wordGas, overflow := math.SafeMul(words, 3)
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+	gas, overflow := math.SafeAdd(base, wordGas)
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+
+	memGas, err := memoryGasCost(mem, memorySize)
+	if err != nil {
+		return 0, err
+	}
+	gas, overflow = math.SafeAdd(gas, memGas)
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+	return gas, nil
+}
+
+// bigToWords converts a 256-bit byte-length stack item to the number of
+// 32-byte words it spans, reporting overflow if the length itself doesn't
+// fit in a uint64.
+func bigToWords(size *big.Int) (uint64, bool) {
+	if size.BitLen() > 64 {
+		return 0, true
+	}
+	return toWordSize(size.Uint64()), false
+}
+
+// gasQuadMemory backs MLOAD/MSTORE/MSTORE8: their own GasFastestStep base
+// plus the quadratic memory expansion fee.
+func gasQuadMemory(gm *Gasometer, env Environment, contract *Contract, stack *stack, mem *Memory, memorySize uint64) (uint64, error) {
+	memGas, err := memoryGasCost(mem, memorySize)
+	if err != nil {
+		return 0, err
+	}
+	gas, overflow := math.SafeAdd(memGas, GasFastestStep)
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+	return gas, nil
+}
+
+func gasSha3(gm *Gasometer, env Environment, contract *Contract, stack *stack, mem *Memory, memorySize uint64) (uint64, error) {
+	words, overflow := bigToWords(stack.data[stack.len()-2])
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+	wordGas, overflow := math.SafeMul(words, 6)
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+	gas, overflow := math.SafeAdd(wordGas, Sha3Gas)
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+
+	memGas, err := memoryGasCost(mem, memorySize)
+	if err != nil {
+		return 0, err
+	}
+	gas, overflow = math.SafeAdd(gas, memGas)
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+	return gas, nil
+}
+
+func gasExp(gm *Gasometer, env Environment, contract *Contract, stack *stack, mem *Memory, memorySize uint64) (uint64, error) {
+	expByteLen := uint64(len(stack.data[stack.len()-2].Bytes()))
+	byteGas, overflow := math.SafeMul(expByteLen, gm.gasTable.ExpByte)
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+	gas, overflow := math.SafeAdd(byteGas, GasSlowStep)
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+	return gas, nil
+}
+
+func gasReturn(gm *Gasometer, env Environment, contract *Contract, stack *stack, mem *Memory, memorySize uint64) (uint64, error) {
+	return memoryGasCost(mem, memorySize)
+}
+
+func gasLog(n int) gasDynamicFunc {
+	return func(gm *Gasometer, env Environment, contract *Contract, stack *stack, mem *Memory, memorySize uint64) (uint64, error) {
+		mSize := stack.data[stack.len()-2]
+		if mSize.BitLen() > 64 {
+			return 0, ErrGasUintOverflow
+		}
+
+		gas, overflow := math.SafeAdd(375, 375*uint64(n))
+		if overflow {
+			return 0, ErrGasUintOverflow
+		}
+		dataGas, overflow := math.SafeMul(mSize.Uint64(), 8)
+		if overflow {
+			return 0, ErrGasUintOverflow
+		}
+		gas, overflow = math.SafeAdd(gas, dataGas)
+		if overflow {
+			return 0, ErrGasUintOverflow
+		}
+
+		memGas, err := memoryGasCost(mem, memorySize)
+		if err != nil {
+			return 0, err
+		}
+		gas, overflow = math.SafeAdd(gas, memGas)
+		if overflow {
+			return 0, ErrGasUintOverflow
+		}
+		return gas, nil
+	}
+}
+
+func gasSStoreLegacy(gm *Gasometer, env Environment, contract *Contract, stack *stack, mem *Memory, memorySize uint64) (uint64, error) {
+	var (
+		gas                  uint64
+		refundCounter        = big.NewInt(0)
+		newValue, storageLoc = stack.data[stack.len()-2], stack.data[stack.len()-1]
+		currentValue         = env.Db().GetState(contract.Address(), common.BigToHash(storageLoc))
+	)
+
+	// This checks for 3 scenario's and calculates gas accordingly:
+	// 1. From a zero-value address to a non-zero value         (NEW VALUE)
+	// 2. From a non-zero value address to a zero-value address (DELETE)
+	// 3. From a non-zero to a non-zero                         (CHANGE)
+	if common.EmptyHash(currentValue) && !common.EmptyHash(common.BigToHash(newValue)) {
+		gas = 20000 // Once per SLOAD operation.
+	} else if !common.EmptyHash(currentValue) && common.EmptyHash(common.BigToHash(newValue)) {
+		refundCounter.Add(refundCounter, big.NewInt(15000))
+		gas = 5000
+	} else {
+		gas = 5000
+	}
+
+	env.Db().AddRefund(refundCounter)
+	return gas, nil
+}
+
+// gasSStoreEIP1283Dynamic is the EIP1283 variant of gasSStoreLegacy. It's a
+// method only because New needs a bound value to install as this entry's
+// Dynamic override when EIP1283 is active; the gm it's given at call time
+// is always the same *Gasometer whose originalSStoreMap it reads and
+// writes.
+func (evm *EVM) gasSStoreEIP1283Dynamic(gm *Gasometer, env Environment, contract *Contract, stack *stack, mem *Memory, memorySize uint64) (uint64, error) {
+	newValue, storageLoc := stack.data[stack.len()-2], stack.data[stack.len()-1]
+	loc := common.BigToAddress(storageLoc)
+	currentValue := env.Db().GetState(contract.Address(), common.BigToHash(storageLoc))
+
+	var originalValue common.Hash
+	if v, ok := gm.originalSStoreMap[loc]; ok {
+		originalValue = v
+	} else {
+		gm.originalSStoreMap[loc] = currentValue
+		originalValue = currentValue
+	}
+
+	return eip1283sstoreGas(env, originalValue.Big(), currentValue.Big(), newValue), nil
+}
+
+// gasCreate backs CREATE/CREATE2: their flat CreateGas base plus the
+// quadratic memory expansion fee.
+func gasCreate(gm *Gasometer, env Environment, contract *Contract, stack *stack, mem *Memory, memorySize uint64) (uint64, error) {
+	memGas, err := memoryGasCost(mem, memorySize)
+	if err != nil {
+		return 0, err
+	}
+	gas, overflow := math.SafeAdd(memGas, CreateGas)
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+	return gas, nil
+}
+
+// gasCallDynamic is a method, rather than a plain gasDynamicFunc, so it can
+// replace the stack's forwarded-gas argument with a value drawn from
+// evm.intPool instead of allocating a fresh big.Int.
+func (evm *EVM) gasCallDynamic(gm *Gasometer, env Environment, contract *Contract, stack *stack, mem *Memory, memorySize uint64) (uint64, error) {
+	gas := gm.gasTable.Calls
+	var overflow bool
+
+	if !env.Db().Exist(common.BigToAddress(stack.data[stack.len()-2])) {
+		if gas, overflow = math.SafeAdd(gas, 25000); overflow {
+			return 0, ErrGasUintOverflow
+		}
+	}
+	if len(stack.data[stack.len()-3].Bytes()) > 0 {
+		if gas, overflow = math.SafeAdd(gas, 9000); overflow {
+			return 0, ErrGasUintOverflow
+		}
+	}
+
+	memGas, err := memoryGasCost(mem, memorySize)
+	if err != nil {
+		return 0, err
+	}
+	if gas, overflow = math.SafeAdd(gas, memGas); overflow {
+		return 0, ErrGasUintOverflow
+	}
+
+	cg, err := callGas(env, gm.gasTable, contract.Gas, gas, stack.data[stack.len()-1])
+	if err != nil {
+		return 0, err
+	}
+	evm.intPool.put(stack.data[stack.len()-1])
+	stack.data[stack.len()-1] = evm.intPool.get().SetUint64(cg)
+
+	if gas, overflow = math.SafeAdd(gas, cg); overflow {
+		return 0, ErrGasUintOverflow
+	}
+	return gas, nil
+}
+
+// gasCallCodeDynamic is the CALLCODE counterpart of gasCallDynamic; see its
+// doc comment.
+func (evm *EVM) gasCallCodeDynamic(gm *Gasometer, env Environment, contract *Contract, stack *stack, mem *Memory, memorySize uint64) (uint64, error) {
+	gas := gm.gasTable.Calls
+	var overflow bool
+
+	if len(stack.data[stack.len()-3].Bytes()) > 0 {
+		if gas, overflow = math.SafeAdd(gas, 9000); overflow {
+			return 0, ErrGasUintOverflow
+		}
+	}
+
+	memGas, err := memoryGasCost(mem, memorySize)
+	if err != nil {
+		return 0, err
+	}
+	if gas, overflow = math.SafeAdd(gas, memGas); overflow {
+		return 0, ErrGasUintOverflow
+	}
+
+	cg, err := callGas(env, gm.gasTable, contract.Gas, gas, stack.data[stack.len()-1])
+	if err != nil {
+		return 0, err
+	}
+	evm.intPool.put(stack.data[stack.len()-1])
+	stack.data[stack.len()-1] = evm.intPool.get().SetUint64(cg)
+
+	if gas, overflow = math.SafeAdd(gas, cg); overflow {
+		return 0, ErrGasUintOverflow
+	}
+	return gas, nil
+}
+
+// gasDelegateCallDynamic is the DELEGATECALL/STATICCALL counterpart of
+// gasCallDynamic; see its doc comment. Neither DELEGATECALL nor STATICCALL
+// forward value, so unlike gasCallDynamic and gasCallCodeDynamic there's no
+// value-transfer surcharge.
+func (evm *EVM) gasDelegateCallDynamic(gm *Gasometer, env Environment, contract *Contract, stack *stack, mem *Memory, memorySize uint64) (uint64, error) {
+	gas := gm.gasTable.Calls
+
+	memGas, err := memoryGasCost(mem, memorySize)
+	if err != nil {
+		return 0, err
+	}
+	var overflow bool
+	if gas, overflow = math.SafeAdd(gas, memGas); overflow {
+		return 0, ErrGasUintOverflow
+	}
+
+	cg, err := callGas(env, gm.gasTable, contract.Gas, gas, stack.data[stack.len()-1])
+	if err != nil {
+		return 0, err
+	}
+	evm.intPool.put(stack.data[stack.len()-1])
+	stack.data[stack.len()-1] = evm.intPool.get().SetUint64(cg)
+
+	if gas, overflow = math.SafeAdd(gas, cg); overflow {
+		return 0, ErrGasUintOverflow
+	}
+	return gas, nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2014 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"testing"
+
+	"github.com/ethereumproject/go-ethereum/common/math"
+)
+
+// TestMemoryGasCostQuadraticBoundary checks that growing memory just past a
+// word boundary charges exactly the marginal fee between the two word
+// counts, and that re-requesting the size already paid for is free.
+func TestMemoryGasCostQuadraticBoundary(t *testing.T) {
+	mem := NewMemory()
+	mem.Resize(32 * 10)
+
+	if cost, err := memoryGasCost(mem, 32*10); err != nil || cost != 0 {
+		t.Fatalf("re-requesting the paid-for size: cost = %d, err = %v, want 0, nil", cost, err)
+	}
+
+	cost, err := memoryGasCost(mem, 32*11)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	paid, _ := memoryExpansionFee(10)
+	want, _ := memoryExpansionFee(11)
+	if cost != want-paid {
+		t.Fatalf("cost = %d, want %d", cost, want-paid)
+	}
+}
+
+// TestMemoryGasCostOverflow checks that a newMemSize so large its word count
+// can't be scaled back to bytes without wrapping a uint64 is reported as
+// ErrGasUintOverflow rather than silently returning a cost of 0.
+func TestMemoryGasCostOverflow(t *testing.T) {
+	mem := NewMemory()
+	if _, err := memoryGasCost(mem, math.MaxUint64-1); err != ErrGasUintOverflow {
+		t.Fatalf("err = %v, want ErrGasUintOverflow", err)
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+
+	"github.com/ethereumproject/go-ethereum/common"
+)
+
+// gasCostCategory groups opcodes whose gas is repriced together across hard
+// forks, so a fork that changes one group's price does it in a single
+// place instead of touching every opcode that happens to share it.
+type gasCostCategory int
+
+const (
+	GckZero gasCostCategory = iota
+	GckBase
+	GckVeryLow
+	GckLow
+	GckMid
+	GckHigh
+
+	// GckAccount covers the GasTable-priced account-access opcodes:
+	// SLOAD, BALANCE, EXTCODESIZE and SUICIDE.
+	GckAccount
+	GckMemory
+	GckCopy
+	GckSha3
+	GckCall
+	GckExp
+	GckLog
+	GckSStore
+
+	// GckExt covers the opcodes priced at the "ext" step, currently just
+	// BLOCKHASH.
+	GckExt
+
+	// GckJumpdest is JUMPDEST's own category: it's charged separately from
+	// GckZero so a fork could reprice it without touching STOP et al.
+	GckJumpdest
+)
+
+// categoryStep holds the constant gas cost backing the flat step
+// categories. The remaining categories are inherently variable -- they
+// always carry a Dynamic func instead, and their entry here is never read.
+var categoryStep = map[gasCostCategory]uint64{
+	GckZero:     0,
+	GckBase:     GasQuickStep,
+	GckVeryLow:  GasFastestStep,
+	GckLow:      GasFastStep,
+	GckMid:      GasMidStep,
+	GckHigh:     GasSlowStep,
+	GckExt:      GasExtStep,
+	GckJumpdest: 1,
+}
+
+// gasDynamicFunc computes an opcode's gas cost from its live stack, memory
+// and environment, for opcodes whose price isn't a flat per-category
+// constant.
+type gasDynamicFunc func(gm *Gasometer, env Environment, contract *Contract, stack *stack, mem *Memory, memSize uint64) (uint64, error)
+
+// GasCost is the gas descriptor attached to a jump table operation in place
+// of a bare gas-cost function. Static opcodes carry only a Category;
+// Dynamic, when set, overrides the category's constant and computes the
+// cost from the opcode's actual arguments instead.
+type GasCost struct {
+	Category gasCostCategory
+	Dynamic  gasDynamicFunc
+}
+
+// constGasCost returns a GasCost priced entirely by its category's
+// constant step cost.
+func constGasCost(category gasCostCategory) GasCost {
+	return GasCost{Category: category}
+}
+
+// dynamicGasCost returns a GasCost priced by fn rather than its category's
+// constant.
+func dynamicGasCost(category gasCostCategory, fn gasDynamicFunc) GasCost {
+	return GasCost{Category: category, Dynamic: fn}
+}
+
+// Gasometer owns everything needed to price and charge for the opcodes of
+// every call frame its EVM runs: the hard-fork-specific GasTable and, for EIP1283, the
+// original-value map SSTORE gas accounting depends on. Pricing no longer
+// lives inline with the jump table: Consume is the one place a GasCost
+// descriptor turns into gas actually deducted from the contract.
+type Gasometer struct {
+	gasTable *GasTable
+
+	// originalSStoreMap remembers, for the lifetime of the EVM that owns
+	// this Gasometer (across every call frame it runs), the value each
+	// touched storage slot held before the first SSTORE to it changed it.
+	// Slots are keyed by location alone. EIP1283 gas accounting needs that
+	// "original" value. It lives here, rather than on the EVM, because
+	// it's purely a gas-accounting concern.
+	originalSStoreMap map[common.Address]common.Hash
+}
+
+// newGasometer returns a Gasometer backed by the given hard fork's
+// GasTable, with a fresh originalSStoreMap for the EVM it's about to
+// price for.
+func newGasometer(gasTable *GasTable) *Gasometer {
+	return &Gasometer{
+		gasTable:          gasTable,
+		originalSStoreMap: make(map[common.Address]common.Hash),
+	}
+}
+
+// Consume prices cost against the current opcode's arguments, deducts it
+// from contract, and reports OutOfGasError if the contract can't afford
+// it. It returns the gas actually charged so a Tracer can report it
+// without recomputing it.
+func (gm *Gasometer) Consume(cost GasCost, env Environment, contract *Contract, stack *stack, mem *Memory, memSize uint64) (uint64, error) {
+	gas := categoryStep[cost.Category]
+	if cost.Dynamic != nil {
+		var err error
+		if gas, err = cost.Dynamic(gm, env, contract, stack, mem, memSize); err != nil {
+			return 0, err
+		}
+	}
+	if !contract.UseGas(gas) {
+		return 0, OutOfGasError
+	}
+	return gas, nil
+}
+
+// eip1283sstoreGas returns the gas an SSTORE costs under EIP1283 and applies
+// whatever refund it earns directly to env's refund counter. The three
+// values it compares are full 256-bit storage words, but the gas this
+// returns is a small, fixed constant, so it's a plain uint64 like every
+// other gas quantity in this package. Refunds are applied as they're
+// discovered, as increments or decrements of the transaction-wide total,
+// rather than threaded back out as a signed delta: a local delta can be
+// momentarily negative (clause 1 below), which uint64 can't represent, but
+// the global counter it adjusts never goes negative, since any decrement
+// only ever reverses a credit the same slot already earned earlier in the
+// transaction.
+func eip1283sstoreGas(env Environment, originalValue, currentValue, newValue *big.Int) (gas uint64) {
+	addRefund := func(n int64) { env.Db().AddRefund(big.NewInt(n)) }
+
+	// EIP1283
+	// If current value equals new value (noop), 200 gas deducted
+	if newValue.Cmp(currentValue) == 0 {
+		return 200
+	}
+
+	// If current value != new value
+	// If original value equals current value (this storage slot has not been changed by the current execution context)
+	// If original value is 0, 20000 gas is deducted.
+	// 	Otherwise, 5000 gas is deducted. If new value is 0, add 15000 gas to refund counter.
+	if originalValue.Cmp(currentValue) == 0 {
+		if originalValue.Cmp(common.Big0) == 0 {
+			return 20000
+		}
+		if newValue.Cmp(common.Big0) == 0 {
+			addRefund(15000)
+		}
+		return 5000
+	}
+
+	// If original value does not equal current value (this storage slot is dirty), 200 gas is deducted. Apply both of the following clauses.
+	// 1. If original value is not 0
+	// If current value is 0 (also means that new value is not 0), remove 15000 gas from refund counter. We can prove that refund counter will never go below 0.
+	// If new value is 0 (also means that current value is not 0), add 15000 gas to refund counter.
+	if originalValue.Cmp(common.Big0) != 0 {
+		if currentValue.Cmp(common.Big0) == 0 {
+			addRefund(-15000)
+		}
+		if newValue.Cmp(common.Big0) == 0 {
+			addRefund(15000)
+		}
+	}
+	// 2. If original value equals new value (this storage slot is reset)
+	// If original value is 0, add 19800 gas to refund counter.
+	// Otherwise, add 4800 gas to refund counter.
+	if originalValue.Cmp(newValue) == 0 {
+		if originalValue.Cmp(common.Big0) == 0 {
+			addRefund(19800)
+		} else {
+			addRefund(4800)
+		}
+	}
+	return 200
+}
@@ -0,0 +1,119 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+	"testing"
+)
+
+// hugeOffset doesn't fit in a uint64 on its own, let alone once a length is
+// added to it, so every memorySizeFunc below must reject it rather than
+// silently truncating it into a tiny, wrong memory size.
+var hugeOffset = new(big.Int).Lsh(big.NewInt(1), 256)
+
+// TestMemorySizeFuncsRejectInvalidOffset checks that every opcode category
+// with its own memorySizeFunc reports ErrGasUintOverflow for a memory
+// offset too large for a real machine to back, rather than wrapping.
+func TestMemorySizeFuncsRejectInvalidOffset(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   memorySizeFunc
+		args []*big.Int
+	}{
+		{"offsetSize2", memoryOffsetSize2, []*big.Int{hugeOffset, big.NewInt(1)}},
+		{"offsetSize3", memoryOffsetSize3, []*big.Int{hugeOffset, big.NewInt(0), big.NewInt(1)}},
+		{"mload", memoryMLoad, []*big.Int{hugeOffset}},
+		{"mstore", memoryMStore, []*big.Int{hugeOffset}},
+		{"mstore8", memoryMStore8, []*big.Int{hugeOffset}},
+		{"extCodeCopy", memoryExtCodeCopy, []*big.Int{big.NewInt(0), hugeOffset, big.NewInt(0), big.NewInt(1)}},
+		{"create", memoryCreate, []*big.Int{big.NewInt(0), hugeOffset, big.NewInt(1)}},
+		{"call", memoryCall, []*big.Int{big.NewInt(0), big.NewInt(0), big.NewInt(0), hugeOffset, big.NewInt(1), big.NewInt(0), big.NewInt(0)}},
+		{"delegateCall", memoryDelegateCall, []*big.Int{big.NewInt(0), big.NewInt(0), hugeOffset, big.NewInt(1), big.NewInt(0), big.NewInt(0)}},
+	}
+
+	for _, test := range tests {
+		s := newstack()
+		// args are listed top of stack first, so push them in reverse.
+		for i := len(test.args) - 1; i >= 0; i-- {
+			s.push(test.args[i])
+		}
+		if _, err := test.fn(s); err != ErrGasUintOverflow {
+			t.Errorf("%s: err = %v, want ErrGasUintOverflow", test.name, err)
+		}
+	}
+}
+
+// TestGasQuadMemoryIncludesBase checks that MLOAD/MSTORE/MSTORE8's dynamic
+// gas func still charges their GasFastestStep base on top of the memory
+// expansion fee, rather than Consume's category constant being the only
+// thing that priced it (Consume's Dynamic result replaces the category
+// constant rather than adding to it).
+func TestGasQuadMemoryIncludesBase(t *testing.T) {
+	gas, err := gasQuadMemory(nil, nil, nil, nil, NewMemory(), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gas != GasFastestStep {
+		t.Fatalf("gas = %d, want %d (the GasFastestStep base, memory untouched)", gas, GasFastestStep)
+	}
+}
+
+// TestGasCreateIncludesBase checks that gasCreate still charges the flat
+// CreateGas base alongside the memory expansion fee.
+func TestGasCreateIncludesBase(t *testing.T) {
+	gas, err := gasCreate(nil, nil, nil, nil, NewMemory(), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gas != CreateGas {
+		t.Fatalf("gas = %d, want %d (the CreateGas base, memory untouched)", gas, CreateGas)
+	}
+}
+
+// TestGasSha3IncludesBase checks that SHA3's dynamic gas func still charges
+// its Sha3Gas base alongside the per-word and memory expansion fees.
+func TestGasSha3IncludesBase(t *testing.T) {
+	s := newstack()
+	s.push(big.NewInt(0)) // length
+	s.push(big.NewInt(0)) // offset
+
+	gas, err := gasSha3(nil, nil, nil, s, NewMemory(), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gas != Sha3Gas {
+		t.Fatalf("gas = %d, want %d (the Sha3Gas base, zero length/memory)", gas, Sha3Gas)
+	}
+}
+
+// TestGasExpIncludesBase checks that EXP's dynamic gas func still charges
+// its GasSlowStep base alongside the per-byte exponent fee.
+func TestGasExpIncludesBase(t *testing.T) {
+	s := newstack()
+	s.push(big.NewInt(0)) // exponent
+	s.push(big.NewInt(2)) // base
+
+	gm := &Gasometer{gasTable: &GasTable{ExpByte: 10}}
+	gas, err := gasExp(gm, nil, nil, s, nil, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gas != GasSlowStep {
+		t.Fatalf("gas = %d, want %d (the GasSlowStep base, zero-byte exponent)", gas, GasSlowStep)
+	}
+}
@@ -0,0 +1,719 @@
+// Copyright 2014 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/crypto"
+)
+
+// This file holds the opcodes that used to be inlined directly in EVM.Run's
+// switch statement. They're instructionFuncs now, installed into the jump
+// table by newJumpTable (or, for the ones that are EVM methods, by New), so
+// the main loop no longer needs to know anything about their individual
+// semantics.
+
+func opStop(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	return nil, nil
+}
+
+// opPc is a method, rather than a plain instructionFunc, so it can push a
+// big.Int reused from evm.intPool instead of allocating a fresh one.
+func (evm *EVM) opPc(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	stack.push(evm.intPool.get().SetUint64(*pc))
+	return nil, nil
+}
+
+func opJump(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	pos := stack.pop()
+	if !contract.jumpdests.has(contract.CodeHash, contract.Code, pos) {
+		nop := contract.GetOp(pos.Uint64())
+		return nil, fmt.Errorf("invalid jump destination (%v) %v", nop, pos)
+	}
+	*pc = pos.Uint64()
+	return nil, nil
+}
+
+func opJumpi(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	pos, cond := stack.pop(), stack.pop()
+	if cond.Sign() != 0 {
+		if !contract.jumpdests.has(contract.CodeHash, contract.Code, pos) {
+			nop := contract.GetOp(pos.Uint64())
+			return nil, fmt.Errorf("invalid jump destination (%v) %v", nop, pos)
+		}
+		*pc = pos.Uint64()
+	} else {
+		*pc++
+	}
+	return nil, nil
+}
+
+func opReturn(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	offset, size := stack.pop(), stack.pop()
+	return memory.GetPtr(offset.Int64(), size.Int64()), nil
+}
+
+func opRevert(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	offset, size := stack.pop(), stack.pop()
+	return memory.GetPtr(offset.Int64(), size.Int64()), nil
+}
+
+// opReturnDataCopy is a method, rather than a plain instructionFunc, so the
+// bounds-check sum it computes can come from evm.intPool instead of a fresh
+// allocation.
+func (evm *EVM) opReturnDataCopy(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	memOffset, dataOffset, length := stack.pop(), stack.pop(), stack.pop()
+
+	data := env.ReturnData()
+	end := evm.intPool.get().Add(dataOffset, length)
+	if end.BitLen() > 64 || uint64(len(data)) < end.Uint64() {
+		evm.intPool.put(memOffset, dataOffset, length, end)
+		return nil, ErrReturnDataOutOfBounds
+	}
+	memory.Set(memOffset.Uint64(), length.Uint64(), data[dataOffset.Uint64():end.Uint64()])
+	evm.intPool.put(memOffset, dataOffset, length, end)
+	return nil, nil
+}
+
+func opSuicide(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	balance := env.Db().GetBalance(contract.Address())
+	env.Db().AddBalance(common.BigToAddress(stack.pop()), balance)
+	env.Db().Suicide(contract.Address())
+	return nil, nil
+}
+
+// opLog returns an instructionFunc emitting a LOG opcode with n indexed
+// topics, shared by LOG0 through LOG4.
+func opLog(n int) instructionFunc {
+	return func(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+		mStart, mSize := stack.pop(), stack.pop()
+		topics := make([]common.Hash, n)
+		for i := 0; i < n; i++ {
+			topics[i] = common.BigToHash(stack.pop())
+		}
+
+		d := memory.GetPtr(mStart.Int64(), mSize.Int64())
+		env.Db().AddLog(&Log{
+			Address: contract.Address(),
+			Topics:  topics,
+			Data:    d,
+		})
+		return nil, nil
+	}
+}
+
+// opDup returns an instructionFunc duplicating the n-th stack item, shared
+// by DUP1 through DUP16.
+func opDup(n int) instructionFunc {
+	return func(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+		stack.dup(n)
+		return nil, nil
+	}
+}
+
+// opSwap returns an instructionFunc swapping the top stack item with the
+// n-th item counting from the top (the top itself being the first), shared
+// by SWAP1 through SWAP16.
+func opSwap(n int) instructionFunc {
+	return func(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+		stack.swap(n)
+		return nil, nil
+	}
+}
+
+// opAdd, and the rest of the arithmetic/comparison/bitwise opcodes below
+// other than opSignExtend and opNot, are
+// methods rather than plain instructionFuncs so the result they push -- or
+// an operand that turns out not to be needed -- can come from or go back to
+// evm.intPool instead of allocating or discarding a big.Int on every step.
+
+func (evm *EVM) opAdd(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	x, y := stack.pop(), stack.pop()
+	stack.push(common.U256(x.Add(x, y)))
+	evm.intPool.put(y)
+	return nil, nil
+}
+
+func (evm *EVM) opSub(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	x, y := stack.pop(), stack.pop()
+	stack.push(common.U256(x.Sub(x, y)))
+	evm.intPool.put(y)
+	return nil, nil
+}
+
+func (evm *EVM) opMul(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	x, y := stack.pop(), stack.pop()
+	stack.push(common.U256(x.Mul(x, y)))
+	evm.intPool.put(y)
+	return nil, nil
+}
+
+func (evm *EVM) opDiv(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	x, y := stack.pop(), stack.pop()
+	if y.Sign() == 0 {
+		stack.push(evm.intPool.getZero())
+		evm.intPool.put(x, y)
+	} else {
+		stack.push(common.U256(x.Div(x, y)))
+		evm.intPool.put(y)
+	}
+	return nil, nil
+}
+
+func (evm *EVM) opSdiv(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	x, y := common.S256(stack.pop()), common.S256(stack.pop())
+	if y.Sign() == 0 {
+		stack.push(evm.intPool.getZero())
+		evm.intPool.put(x, y)
+		return nil, nil
+	}
+	n := evm.intPool.get()
+	if x.Sign() != y.Sign() {
+		n.SetInt64(-1)
+	} else {
+		n.SetInt64(1)
+	}
+	res := x.Div(x.Abs(x), y.Abs(y))
+	res.Mul(res, n)
+	stack.push(common.U256(res))
+	evm.intPool.put(y, n)
+	return nil, nil
+}
+
+func (evm *EVM) opMod(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	x, y := stack.pop(), stack.pop()
+	if y.Sign() == 0 {
+		stack.push(evm.intPool.getZero())
+		evm.intPool.put(x, y)
+	} else {
+		stack.push(common.U256(x.Mod(x, y)))
+		evm.intPool.put(y)
+	}
+	return nil, nil
+}
+
+func (evm *EVM) opSmod(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	x, y := common.S256(stack.pop()), common.S256(stack.pop())
+	if y.Sign() == 0 {
+		stack.push(evm.intPool.getZero())
+		evm.intPool.put(x, y)
+		return nil, nil
+	}
+	n := evm.intPool.get()
+	if x.Sign() < 0 {
+		n.SetInt64(-1)
+	} else {
+		n.SetInt64(1)
+	}
+	res := x.Mod(x.Abs(x), y.Abs(y))
+	res.Mul(res, n)
+	stack.push(common.U256(res))
+	evm.intPool.put(y, n)
+	return nil, nil
+}
+
+func (evm *EVM) opAddmod(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	x, y, m := stack.pop(), stack.pop(), stack.pop()
+	if m.Sign() == 0 {
+		stack.push(evm.intPool.getZero())
+		evm.intPool.put(x, y, m)
+	} else {
+		stack.push(common.U256(x.Add(x, y).Mod(x, m)))
+		evm.intPool.put(y, m)
+	}
+	return nil, nil
+}
+
+func (evm *EVM) opMulmod(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	x, y, m := stack.pop(), stack.pop(), stack.pop()
+	if m.Sign() == 0 {
+		stack.push(evm.intPool.getZero())
+		evm.intPool.put(x, y, m)
+	} else {
+		stack.push(common.U256(x.Mul(x, y).Mod(x, m)))
+		evm.intPool.put(y, m)
+	}
+	return nil, nil
+}
+
+func opSignExtend(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	back, num := stack.pop(), stack.pop()
+	if back.Cmp(big.NewInt(31)) < 0 {
+		bit := uint(back.Uint64()*8 + 7)
+		mask := new(big.Int).Lsh(common.Big1, bit)
+		mask.Sub(mask, common.Big1)
+		if num.Bit(int(bit)) > 0 {
+			num.Or(num, mask.Not(mask))
+		} else {
+			num.And(num, mask)
+		}
+	}
+	stack.push(common.U256(num))
+	return nil, nil
+}
+
+func (evm *EVM) opLt(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	x, y := stack.pop(), stack.pop()
+	if x.Cmp(y) < 0 {
+		stack.push(evm.intPool.get().SetUint64(1))
+	} else {
+		stack.push(evm.intPool.getZero())
+	}
+	evm.intPool.put(x, y)
+	return nil, nil
+}
+
+func (evm *EVM) opGt(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	x, y := stack.pop(), stack.pop()
+	if x.Cmp(y) > 0 {
+		stack.push(evm.intPool.get().SetUint64(1))
+	} else {
+		stack.push(evm.intPool.getZero())
+	}
+	evm.intPool.put(x, y)
+	return nil, nil
+}
+
+func (evm *EVM) opSlt(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	x, y := common.S256(stack.pop()), common.S256(stack.pop())
+	if x.Cmp(y) < 0 {
+		stack.push(evm.intPool.get().SetUint64(1))
+	} else {
+		stack.push(evm.intPool.getZero())
+	}
+	evm.intPool.put(x, y)
+	return nil, nil
+}
+
+func (evm *EVM) opSgt(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	x, y := common.S256(stack.pop()), common.S256(stack.pop())
+	if x.Cmp(y) > 0 {
+		stack.push(evm.intPool.get().SetUint64(1))
+	} else {
+		stack.push(evm.intPool.getZero())
+	}
+	evm.intPool.put(x, y)
+	return nil, nil
+}
+
+func (evm *EVM) opEq(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	x, y := stack.pop(), stack.pop()
+	if x.Cmp(y) == 0 {
+		stack.push(evm.intPool.get().SetUint64(1))
+	} else {
+		stack.push(evm.intPool.getZero())
+	}
+	evm.intPool.put(x, y)
+	return nil, nil
+}
+
+func (evm *EVM) opIszero(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	x := stack.pop()
+	if x.Sign() == 0 {
+		stack.push(evm.intPool.get().SetUint64(1))
+	} else {
+		stack.push(evm.intPool.getZero())
+	}
+	evm.intPool.put(x)
+	return nil, nil
+}
+
+func (evm *EVM) opAnd(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	x, y := stack.pop(), stack.pop()
+	stack.push(x.And(x, y))
+	evm.intPool.put(y)
+	return nil, nil
+}
+
+func (evm *EVM) opOr(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	x, y := stack.pop(), stack.pop()
+	stack.push(x.Or(x, y))
+	evm.intPool.put(y)
+	return nil, nil
+}
+
+func (evm *EVM) opXor(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	x, y := stack.pop(), stack.pop()
+	stack.push(x.Xor(x, y))
+	evm.intPool.put(y)
+	return nil, nil
+}
+
+func opNot(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	x := stack.pop()
+	stack.push(common.U256(x.Not(x)))
+	return nil, nil
+}
+
+func (evm *EVM) opByte(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	th, val := stack.pop(), stack.pop()
+	if th.Cmp(common.Big32) < 0 {
+		b := byte(val.Div(val, common.BigPow(256, 31-int64(th.Uint64()))).Uint64() & 0xff)
+		stack.push(evm.intPool.get().SetUint64(uint64(b)))
+	} else {
+		stack.push(evm.intPool.getZero())
+	}
+	evm.intPool.put(th, val)
+	return nil, nil
+}
+
+func opAddress(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	stack.push(common.Bytes2Big(contract.Address().Bytes()))
+	return nil, nil
+}
+
+func opOrigin(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	stack.push(common.Bytes2Big(env.Origin().Bytes()))
+	return nil, nil
+}
+
+func opCaller(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	stack.push(common.Bytes2Big(contract.Caller().Bytes()))
+	return nil, nil
+}
+
+func opCallValue(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	stack.push(new(big.Int).Set(contract.Value()))
+	return nil, nil
+}
+
+func opCalldataLoad(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	offset := stack.pop()
+	stack.push(common.Bytes2Big(common.RightPadBytes(getData(contract.Input, offset, big.NewInt(32)), 32)))
+	return nil, nil
+}
+
+func opCalldataSize(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	stack.push(new(big.Int).SetUint64(uint64(len(contract.Input))))
+	return nil, nil
+}
+
+func opCodeSize(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	stack.push(new(big.Int).SetUint64(uint64(len(contract.Code))))
+	return nil, nil
+}
+
+func opGasprice(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	stack.push(new(big.Int).Set(env.GasPrice()))
+	return nil, nil
+}
+
+func opReturnDataSize(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	stack.push(new(big.Int).SetUint64(uint64(len(env.ReturnData()))))
+	return nil, nil
+}
+
+func opBlockhash(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	num := stack.pop()
+
+	n := new(big.Int).Sub(env.BlockNumber(), common.Big257)
+	if num.Cmp(n) > 0 && num.Cmp(env.BlockNumber()) < 0 {
+		stack.push(common.Bytes2Big(env.GetHash(num.Uint64()).Bytes()))
+	} else {
+		stack.push(new(big.Int))
+	}
+	return nil, nil
+}
+
+func opCoinbase(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	stack.push(common.Bytes2Big(env.Coinbase().Bytes()))
+	return nil, nil
+}
+
+func opTimestamp(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	stack.push(common.U256(new(big.Int).Set(env.Time())))
+	return nil, nil
+}
+
+func opNumber(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	stack.push(common.U256(new(big.Int).Set(env.BlockNumber())))
+	return nil, nil
+}
+
+func opDifficulty(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	stack.push(common.U256(new(big.Int).Set(env.Difficulty())))
+	return nil, nil
+}
+
+func opGasLimit(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	stack.push(common.U256(new(big.Int).Set(env.GasLimit())))
+	return nil, nil
+}
+
+func opPop(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	stack.pop()
+	return nil, nil
+}
+
+func opMsize(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	stack.push(new(big.Int).SetUint64(uint64(memory.Len())))
+	return nil, nil
+}
+
+func opGas(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	stack.push(new(big.Int).SetUint64(contract.Gas))
+	return nil, nil
+}
+
+func opJumpdest(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	return nil, nil
+}
+
+func opSha3(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	offset, size := stack.pop(), stack.pop()
+	data := memory.GetPtr(offset.Int64(), size.Int64())
+	stack.push(common.Bytes2Big(crypto.Keccak256(data)))
+	return nil, nil
+}
+
+func opExp(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	base, exponent := stack.pop(), stack.pop()
+	stack.push(common.U256(new(big.Int).Exp(base, exponent, nil)))
+	return nil, nil
+}
+
+func opBalance(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	addr := common.BigToAddress(stack.pop())
+	stack.push(new(big.Int).Set(env.Db().GetBalance(addr)))
+	return nil, nil
+}
+
+func opExtCodeSize(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	addr := common.BigToAddress(stack.pop())
+	stack.push(new(big.Int).SetUint64(uint64(env.Db().GetCodeSize(addr))))
+	return nil, nil
+}
+
+func opExtCodeCopy(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	var (
+		addr                  = common.BigToAddress(stack.pop())
+		memOffset, codeOffset = stack.pop(), stack.pop()
+		length                = stack.pop()
+	)
+	codeCopy := getData(env.Db().GetCode(addr), codeOffset, length)
+	memory.Set(memOffset.Uint64(), length.Uint64(), codeCopy)
+	return nil, nil
+}
+
+func opCallDataCopy(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	var (
+		memOffset, dataOffset = stack.pop(), stack.pop()
+		length                = stack.pop()
+	)
+	data := getData(contract.Input, dataOffset, length)
+	memory.Set(memOffset.Uint64(), length.Uint64(), data)
+	return nil, nil
+}
+
+func opCodeCopy(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	var (
+		memOffset, codeOffset = stack.pop(), stack.pop()
+		length                = stack.pop()
+	)
+	codeCopy := getData(contract.Code, codeOffset, length)
+	memory.Set(memOffset.Uint64(), length.Uint64(), codeCopy)
+	return nil, nil
+}
+
+func opMload(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	offset := stack.pop()
+	stack.push(common.Bytes2Big(memory.GetPtr(offset.Int64(), 32)))
+	return nil, nil
+}
+
+func opMstore(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	mStart, val := stack.pop(), stack.pop()
+	memory.Set(mStart.Uint64(), 32, common.LeftPadBytes(val.Bytes(), 32))
+	return nil, nil
+}
+
+func opMstore8(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	off, val := stack.pop(), stack.pop()
+	memory.Set(off.Uint64(), 1, []byte{byte(val.Uint64())})
+	return nil, nil
+}
+
+func opSload(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	loc := common.BigToHash(stack.pop())
+	stack.push(env.Db().GetState(contract.Address(), loc).Big())
+	return nil, nil
+}
+
+func opSstore(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	loc, val := common.BigToHash(stack.pop()), stack.pop()
+	env.Db().SetState(contract.Address(), loc, common.BigToHash(val))
+	return nil, nil
+}
+
+// opCreate and the rest of the CALL/CREATE family below hand execution off
+// to the Environment, which is what actually recurses back into EVM.Run for
+// the callee -- the same entry point CALL-family gas forwarding in
+// gas_table.go already charges for.
+
+func opCreate(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	var (
+		value        = stack.pop()
+		offset, size = stack.pop(), stack.pop()
+		input        = memory.GetPtr(offset.Int64(), size.Int64())
+		gas          = contract.Gas
+	)
+	contract.UseGas(contract.Gas)
+	ret, addr, err := env.Create(contract, input, gas, value)
+	if err != nil {
+		stack.push(new(big.Int))
+	} else {
+		stack.push(common.Bytes2Big(addr.Bytes()))
+	}
+	if err == ErrExecutionReverted {
+		return ret, nil
+	}
+	return nil, nil
+}
+
+func opCreate2(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	var (
+		endowment    = stack.pop()
+		offset, size = stack.pop(), stack.pop()
+		salt         = stack.pop()
+		input        = memory.GetPtr(offset.Int64(), size.Int64())
+		gas          = contract.Gas
+	)
+	contract.UseGas(contract.Gas)
+	ret, addr, err := env.Create2(contract, input, gas, endowment, salt)
+	if err != nil {
+		stack.push(new(big.Int))
+	} else {
+		stack.push(common.Bytes2Big(addr.Bytes()))
+	}
+	if err == ErrExecutionReverted {
+		return ret, nil
+	}
+	return nil, nil
+}
+
+func opCall(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	gas := stack.pop().Uint64()
+	addr, value := stack.pop(), stack.pop()
+	inOffset, inSize := stack.pop(), stack.pop()
+	retOffset, retSize := stack.pop(), stack.pop()
+	address := common.BigToAddress(addr)
+
+	args := memory.GetPtr(inOffset.Int64(), inSize.Int64())
+	ret, err := env.Call(contract, address, args, gas, value)
+	if err != nil {
+		stack.push(new(big.Int))
+	} else {
+		stack.push(big.NewInt(1))
+	}
+	if err == nil || err == ErrExecutionReverted {
+		memory.Set(retOffset.Uint64(), retSize.Uint64(), ret)
+	}
+	return ret, nil
+}
+
+func opCallCode(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	gas := stack.pop().Uint64()
+	addr, value := stack.pop(), stack.pop()
+	inOffset, inSize := stack.pop(), stack.pop()
+	retOffset, retSize := stack.pop(), stack.pop()
+	address := common.BigToAddress(addr)
+
+	args := memory.GetPtr(inOffset.Int64(), inSize.Int64())
+	ret, err := env.CallCode(contract, address, args, gas, value)
+	if err != nil {
+		stack.push(new(big.Int))
+	} else {
+		stack.push(big.NewInt(1))
+	}
+	if err == nil || err == ErrExecutionReverted {
+		memory.Set(retOffset.Uint64(), retSize.Uint64(), ret)
+	}
+	return ret, nil
+}
+
+func opDelegateCall(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	gas := stack.pop().Uint64()
+	addr := stack.pop()
+	inOffset, inSize := stack.pop(), stack.pop()
+	retOffset, retSize := stack.pop(), stack.pop()
+	address := common.BigToAddress(addr)
+
+	args := memory.GetPtr(inOffset.Int64(), inSize.Int64())
+	ret, err := env.DelegateCall(contract, address, args, gas)
+	if err != nil {
+		stack.push(new(big.Int))
+	} else {
+		stack.push(big.NewInt(1))
+	}
+	if err == nil || err == ErrExecutionReverted {
+		memory.Set(retOffset.Uint64(), retSize.Uint64(), ret)
+	}
+	return ret, nil
+}
+
+func opStaticCall(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+	gas := stack.pop().Uint64()
+	addr := stack.pop()
+	inOffset, inSize := stack.pop(), stack.pop()
+	retOffset, retSize := stack.pop(), stack.pop()
+	address := common.BigToAddress(addr)
+
+	args := memory.GetPtr(inOffset.Int64(), inSize.Int64())
+	ret, err := env.StaticCall(contract, address, args, gas)
+	if err != nil {
+		stack.push(new(big.Int))
+	} else {
+		stack.push(big.NewInt(1))
+	}
+	if err == nil || err == ErrExecutionReverted {
+		memory.Set(retOffset.Uint64(), retSize.Uint64(), ret)
+	}
+	return ret, nil
+}
+
+// getData returns size bytes of data starting at offset, right-padded with
+// zeroes if the range runs past the end of data. offset and size are full
+// stack words rather than plain ints: CALLDATALOAD and the PUSH opcodes both
+// read their slice bounds straight off the stack or the code, which can
+// exceed what an int can hold on a contract deliberately built to probe
+// this.
+func getData(data []byte, offset, size *big.Int) []byte {
+	dlen := big.NewInt(int64(len(data)))
+
+	start := common.BigMin(offset, dlen)
+	end := common.BigMin(new(big.Int).Add(start, size), dlen)
+	return common.RightPadBytes(data[start.Uint64():end.Uint64()], int(size.Uint64()))
+}
+
+// makePush returns an instructionFunc pushing the pushByteSize bytes
+// following the opcode onto the stack, shared by PUSH1 through PUSH32. size
+// (equal to pushByteSize) is how far the generated func must additionally
+// advance pc, on top of the main loop's own pc++ for the opcode byte
+// itself. It's a method, rather than a plain instructionFunc factory, so the
+// closures it returns can push a value drawn from evm.intPool instead of
+// allocating a fresh big.Int on every PUSH.
+func (evm *EVM) makePush(size uint64, pushByteSize int) instructionFunc {
+	return func(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error) {
+		byts := getData(contract.Code, new(big.Int).SetUint64(*pc+1), big.NewInt(int64(pushByteSize)))
+		stack.push(evm.intPool.get().SetBytes(byts))
+		*pc += size
+		return nil, nil
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+//go:build check_intpool
+// +build check_intpool
+
+package vm
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// This file is only compiled in with -tags check_intpool. It makes
+// intPool.put panic the moment a *big.Int pointer is handed back to the
+// pool while an equal pointer is already sitting in it, which is the
+// signature of an aliasing bug: two still-live values silently sharing the
+// same backing storage. It's a development-time check, not something
+// that should run in production; the bookkeeping it does is not free.
+func init() {
+	verifyPoolPut = func(pool *intPool, is []*big.Int) {
+		seen := make(map[*big.Int]bool, len(is))
+		for _, i := range is {
+			if seen[i] {
+				panic(fmt.Sprintf("intPool: %p put back twice in the same call", i))
+			}
+			seen[i] = true
+		}
+		for _, resident := range pool.pool.data {
+			for _, i := range is {
+				if resident == i {
+					panic(fmt.Sprintf("intPool: %p already resides in the pool", i))
+				}
+			}
+		}
+	}
+}
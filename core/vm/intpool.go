@@ -0,0 +1,74 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import "math/big"
+
+// poolLimit caps how many *big.Int values an intPool holds onto. Beyond
+// this, put simply drops the value for the garbage collector to reclaim
+// rather than growing the pool without bound.
+const poolLimit = 256
+
+// verifyPoolPut is overridden by int_pool_verifier.go when built with the
+// check_intpool tag. It exists here, rather than only in the tagged file,
+// so intPool.put has something to call regardless of how the package is
+// built.
+var verifyPoolPut = func(pool *intPool, is []*big.Int) {}
+
+// intPool is a stack-backed cache of *big.Int values, reused across opcode
+// executions so the interpreter's hot path doesn't allocate a fresh big.Int
+// for nearly every instruction. Each EVM owns its own intPool; it is not
+// safe for concurrent use.
+type intPool struct {
+	pool *stack
+}
+
+// newIntPool returns an empty intPool.
+func newIntPool() *intPool {
+	return &intPool{pool: newstack()}
+}
+
+// get returns a *big.Int from the pool, or a freshly allocated one if the
+// pool is empty. Its value is whatever a previous caller left behind; the
+// caller is responsible for setting it before use.
+func (p *intPool) get() *big.Int {
+	if p.pool.len() > 0 {
+		return p.pool.pop()
+	}
+	return new(big.Int)
+}
+
+// getZero is like get, but guarantees the returned value is zero.
+func (p *intPool) getZero() *big.Int {
+	if p.pool.len() > 0 {
+		return p.pool.pop().SetUint64(0)
+	}
+	return new(big.Int)
+}
+
+// put returns values to the pool once the caller is done with them, so a
+// later get or getZero can reuse their backing storage instead of
+// allocating. Callers must not read from a value after putting it back.
+func (p *intPool) put(is ...*big.Int) {
+	verifyPoolPut(p, is)
+	if p.pool.len() > poolLimit {
+		return
+	}
+	for _, i := range is {
+		p.pool.push(i)
+	}
+}
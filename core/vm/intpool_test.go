@@ -0,0 +1,56 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+	"testing"
+)
+
+// addLoopIterations is how many times each benchmark below drives ADD, the
+// way a loop body like "acc = acc + 1" would over that many iterations.
+const addLoopIterations = 32
+
+// BenchmarkIntPoolOpAdd drives evm.opAdd itself -- the actual instructionFunc
+// the jump table installs for ADD -- rather than calling intPool.get/put
+// directly, so it measures the allocation win on the real opcode hot path
+// instead of just the pool's own bookkeeping.
+func BenchmarkIntPoolOpAdd(b *testing.B) {
+	evm := &EVM{intPool: newIntPool()}
+	var pc uint64
+	for i := 0; i < b.N; i++ {
+		s := newstack()
+		s.push(evm.intPool.getZero())
+		for n := 0; n < addLoopIterations; n++ {
+			s.push(evm.intPool.get().SetUint64(1))
+			evm.opAdd(&pc, nil, nil, nil, s)
+		}
+		evm.intPool.put(s.pop())
+	}
+}
+
+// BenchmarkBigIntOpAddNoPool is the same ADD loop allocating a fresh big.Int
+// for every operand instead of drawing from evm.intPool, for comparison
+// against BenchmarkIntPoolOpAdd.
+func BenchmarkBigIntOpAddNoPool(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		acc := new(big.Int)
+		for n := 0; n < addLoopIterations; n++ {
+			acc.Add(acc, big.NewInt(1))
+		}
+	}
+}
@@ -0,0 +1,610 @@
+// Copyright 2014 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"errors"
+	"math/big"
+)
+
+// errStackOverflow is returned when executing an opcode would leave more
+// than stackLimit items on the stack.
+var errStackOverflow = errors.New("stack limit reached")
+
+// stackLimit is the deepest the EVM stack may grow.
+const stackLimit = 1024
+
+// instructionFunc executes an opcode against the current call frame. It may
+// move the program counter itself (jumps) and may return data that becomes
+// either the return value of the call (halts) or the "return data" exposed
+// to RETURNDATACOPY (returns).
+type instructionFunc func(pc *uint64, env Environment, contract *Contract, memory *Memory, stack *stack) ([]byte, error)
+
+// memorySizeFunc returns the number of bytes memory must be resized to
+// before the opcode executes, or an error if the requested size overflows a
+// uint64. A nil func means the opcode doesn't touch memory.
+type memorySizeFunc func(stack *stack) (uint64, error)
+
+// stackValidationFunc checks that the stack holds enough items for the
+// opcode to execute, returning an error describing the shortfall otherwise.
+type stackValidationFunc func(stack *stack) error
+
+// operation bundles together everything the interpreter needs to validate,
+// cost and execute a single opcode, plus a handful of flags describing how
+// the main loop should react once execute has run.
+type operation struct {
+	execute       instructionFunc
+	gasCost       GasCost
+	memorySize    memorySizeFunc
+	validateStack stackValidationFunc
+
+	halts   bool // halts the execution, returning the data from execute
+	jumps   bool // execute moved the pc itself, the loop must not bump it
+	writes  bool // modifies state, relevant for read-only call frames
+	reverts bool // execution reverted, state changes must be undone
+	returns bool // sets the "return data" buffer used by RETURNDATACOPY
+	valid   bool // whether this entry is a real, runnable opcode
+}
+
+// JumpTable maps every possible opcode byte to its operation. Invalid
+// opcodes are represented by the zero value, whose valid flag is false.
+// It's exported, unlike operation, so a Config.JumpTable override at least
+// has a type to declare a variable of and pass around -- building one from
+// scratch still goes through NewJumpTable, since operation's fields aren't
+// exported.
+type JumpTable [256]operation
+
+// NewJumpTable is the exported entry point to newJumpTable, for callers
+// outside this package that want a starting table to override entries on
+// (by copying from this one; operation's own fields stay private) before
+// assigning it to Config.JumpTable.
+func NewJumpTable(ruleSet RuleSet, blockNumber *big.Int) JumpTable {
+	return newJumpTable(ruleSet, blockNumber)
+}
+
+// newJumpTable builds the jump table for the ruleset active at blockNumber.
+// Hard forks that add or re-price opcodes do so by overriding individual
+// table entries after constructing the base table, so supporting a new EIP
+// is a matter of changing one entry rather than threading a new branch
+// through the interpreter's main loop. Opcodes introduced by a later fork
+// are marked invalid until that fork's ruleset check is satisfied, so a
+// contract replayed against an earlier block aborts with "invalid opcode"
+// instead of silently running code it couldn't have run at the time.
+func newJumpTable(ruleSet RuleSet, blockNumber *big.Int) JumpTable {
+	var (
+		jt          JumpTable
+		isHomestead = ruleSet.IsHomestead(blockNumber)
+		isECIP1045B = ruleSet.IsECIP1045B(blockNumber)
+	)
+
+	jt[STOP] = operation{
+		execute:       opStop,
+		gasCost:       constGasCost(GckZero),
+		validateStack: minStack(0, 0),
+		halts:         true,
+		valid:         true,
+	}
+	jt[ADD] = operation{
+		// execute is filled in by New: this opcode's result can come
+		// from evm.intPool instead of a fresh allocation.
+		gasCost:       constGasCost(GckVeryLow),
+		validateStack: minStack(2, 1),
+		valid:         true,
+	}
+	jt[MUL] = operation{
+		// execute is filled in by New: this opcode's result can come
+		// from evm.intPool instead of a fresh allocation.
+		gasCost:       constGasCost(GckLow),
+		validateStack: minStack(2, 1),
+		valid:         true,
+	}
+	jt[SUB] = operation{
+		// execute is filled in by New: this opcode's result can come
+		// from evm.intPool instead of a fresh allocation.
+		gasCost:       constGasCost(GckVeryLow),
+		validateStack: minStack(2, 1),
+		valid:         true,
+	}
+	jt[DIV] = operation{
+		// execute is filled in by New: this opcode's result can come
+		// from evm.intPool instead of a fresh allocation.
+		gasCost:       constGasCost(GckLow),
+		validateStack: minStack(2, 1),
+		valid:         true,
+	}
+	jt[SDIV] = operation{
+		// execute is filled in by New: this opcode's result can come
+		// from evm.intPool instead of a fresh allocation.
+		gasCost:       constGasCost(GckLow),
+		validateStack: minStack(2, 1),
+		valid:         true,
+	}
+	jt[MOD] = operation{
+		// execute is filled in by New: this opcode's result can come
+		// from evm.intPool instead of a fresh allocation.
+		gasCost:       constGasCost(GckLow),
+		validateStack: minStack(2, 1),
+		valid:         true,
+	}
+	jt[SMOD] = operation{
+		// execute is filled in by New: this opcode's result can come
+		// from evm.intPool instead of a fresh allocation.
+		gasCost:       constGasCost(GckLow),
+		validateStack: minStack(2, 1),
+		valid:         true,
+	}
+	jt[ADDMOD] = operation{
+		// execute is filled in by New: this opcode's result can come
+		// from evm.intPool instead of a fresh allocation.
+		gasCost:       constGasCost(GckMid),
+		validateStack: minStack(3, 1),
+		valid:         true,
+	}
+	jt[MULMOD] = operation{
+		// execute is filled in by New: this opcode's result can come
+		// from evm.intPool instead of a fresh allocation.
+		gasCost:       constGasCost(GckMid),
+		validateStack: minStack(3, 1),
+		valid:         true,
+	}
+	jt[SIGNEXTEND] = operation{
+		execute:       opSignExtend,
+		gasCost:       constGasCost(GckLow),
+		validateStack: minStack(2, 1),
+		valid:         true,
+	}
+	jt[LT] = operation{
+		// execute is filled in by New: this opcode's result can come
+		// from evm.intPool instead of a fresh allocation.
+		gasCost:       constGasCost(GckVeryLow),
+		validateStack: minStack(2, 1),
+		valid:         true,
+	}
+	jt[GT] = operation{
+		// execute is filled in by New: this opcode's result can come
+		// from evm.intPool instead of a fresh allocation.
+		gasCost:       constGasCost(GckVeryLow),
+		validateStack: minStack(2, 1),
+		valid:         true,
+	}
+	jt[SLT] = operation{
+		// execute is filled in by New: this opcode's result can come
+		// from evm.intPool instead of a fresh allocation.
+		gasCost:       constGasCost(GckVeryLow),
+		validateStack: minStack(2, 1),
+		valid:         true,
+	}
+	jt[SGT] = operation{
+		// execute is filled in by New: this opcode's result can come
+		// from evm.intPool instead of a fresh allocation.
+		gasCost:       constGasCost(GckVeryLow),
+		validateStack: minStack(2, 1),
+		valid:         true,
+	}
+	jt[EQ] = operation{
+		// execute is filled in by New: this opcode's result can come
+		// from evm.intPool instead of a fresh allocation.
+		gasCost:       constGasCost(GckVeryLow),
+		validateStack: minStack(2, 1),
+		valid:         true,
+	}
+	jt[ISZERO] = operation{
+		// execute is filled in by New: this opcode's result can come
+		// from evm.intPool instead of a fresh allocation.
+		gasCost:       constGasCost(GckVeryLow),
+		validateStack: minStack(1, 1),
+		valid:         true,
+	}
+	jt[AND] = operation{
+		// execute is filled in by New: this opcode's result can come
+		// from evm.intPool instead of a fresh allocation.
+		gasCost:       constGasCost(GckVeryLow),
+		validateStack: minStack(2, 1),
+		valid:         true,
+	}
+	jt[OR] = operation{
+		// execute is filled in by New: this opcode's result can come
+		// from evm.intPool instead of a fresh allocation.
+		gasCost:       constGasCost(GckVeryLow),
+		validateStack: minStack(2, 1),
+		valid:         true,
+	}
+	jt[XOR] = operation{
+		// execute is filled in by New: this opcode's result can come
+		// from evm.intPool instead of a fresh allocation.
+		gasCost:       constGasCost(GckVeryLow),
+		validateStack: minStack(2, 1),
+		valid:         true,
+	}
+	jt[NOT] = operation{
+		execute:       opNot,
+		gasCost:       constGasCost(GckVeryLow),
+		validateStack: minStack(1, 1),
+		valid:         true,
+	}
+	jt[BYTE] = operation{
+		// execute is filled in by New: this opcode's result can come
+		// from evm.intPool instead of a fresh allocation.
+		gasCost:       constGasCost(GckVeryLow),
+		validateStack: minStack(2, 1),
+		valid:         true,
+	}
+	jt[ADDRESS] = operation{
+		execute:       opAddress,
+		gasCost:       constGasCost(GckBase),
+		validateStack: minStack(0, 1),
+		valid:         true,
+	}
+	jt[ORIGIN] = operation{
+		execute:       opOrigin,
+		gasCost:       constGasCost(GckBase),
+		validateStack: minStack(0, 1),
+		valid:         true,
+	}
+	jt[CALLER] = operation{
+		execute:       opCaller,
+		gasCost:       constGasCost(GckBase),
+		validateStack: minStack(0, 1),
+		valid:         true,
+	}
+	jt[CALLVALUE] = operation{
+		execute:       opCallValue,
+		gasCost:       constGasCost(GckBase),
+		validateStack: minStack(0, 1),
+		valid:         true,
+	}
+	jt[CALLDATALOAD] = operation{
+		execute:       opCalldataLoad,
+		gasCost:       constGasCost(GckVeryLow),
+		validateStack: minStack(1, 1),
+		valid:         true,
+	}
+	jt[CALLDATASIZE] = operation{
+		execute:       opCalldataSize,
+		gasCost:       constGasCost(GckBase),
+		validateStack: minStack(0, 1),
+		valid:         true,
+	}
+	jt[CODESIZE] = operation{
+		execute:       opCodeSize,
+		gasCost:       constGasCost(GckBase),
+		validateStack: minStack(0, 1),
+		valid:         true,
+	}
+	jt[GASPRICE] = operation{
+		execute:       opGasprice,
+		gasCost:       constGasCost(GckBase),
+		validateStack: minStack(0, 1),
+		valid:         true,
+	}
+	jt[RETURNDATASIZE] = operation{
+		execute:       opReturnDataSize,
+		gasCost:       constGasCost(GckBase),
+		validateStack: minStack(0, 1),
+		valid:         isECIP1045B,
+	}
+	jt[BLOCKHASH] = operation{
+		execute:       opBlockhash,
+		gasCost:       constGasCost(GckExt),
+		validateStack: minStack(1, 1),
+		valid:         true,
+	}
+	jt[COINBASE] = operation{
+		execute:       opCoinbase,
+		gasCost:       constGasCost(GckBase),
+		validateStack: minStack(0, 1),
+		valid:         true,
+	}
+	jt[TIMESTAMP] = operation{
+		execute:       opTimestamp,
+		gasCost:       constGasCost(GckBase),
+		validateStack: minStack(0, 1),
+		valid:         true,
+	}
+	jt[NUMBER] = operation{
+		execute:       opNumber,
+		gasCost:       constGasCost(GckBase),
+		validateStack: minStack(0, 1),
+		valid:         true,
+	}
+	jt[DIFFICULTY] = operation{
+		execute:       opDifficulty,
+		gasCost:       constGasCost(GckBase),
+		validateStack: minStack(0, 1),
+		valid:         true,
+	}
+	jt[GASLIMIT] = operation{
+		execute:       opGasLimit,
+		gasCost:       constGasCost(GckBase),
+		validateStack: minStack(0, 1),
+		valid:         true,
+	}
+	jt[POP] = operation{
+		execute:       opPop,
+		gasCost:       constGasCost(GckBase),
+		validateStack: minStack(1, 0),
+		valid:         true,
+	}
+	jt[MSIZE] = operation{
+		execute:       opMsize,
+		gasCost:       constGasCost(GckBase),
+		validateStack: minStack(0, 1),
+		valid:         true,
+	}
+	jt[GAS] = operation{
+		execute:       opGas,
+		gasCost:       constGasCost(GckBase),
+		validateStack: minStack(0, 1),
+		valid:         true,
+	}
+	jt[JUMPDEST] = operation{
+		execute:       opJumpdest,
+		gasCost:       constGasCost(GckJumpdest),
+		validateStack: minStack(0, 0),
+		valid:         true,
+	}
+	for i := byte(PUSH1); i <= byte(PUSH32); i++ {
+		n := int(OpCode(i) - PUSH1 + 1)
+		jt[i] = operation{
+			// execute is filled in by New: makePush is a method so the
+			// pushed value can come from evm.intPool.
+			gasCost:       constGasCost(GckVeryLow),
+			validateStack: minStack(0, 1),
+			valid:         true,
+		}
+	}
+	jt[PC] = operation{
+		// execute is filled in by New once the EVM exists: opPc is a
+		// method, bound to the EVM that owns the intPool it pushes out of.
+		gasCost:       constGasCost(GckBase),
+		validateStack: minStack(0, 1),
+		valid:         true,
+	}
+	jt[JUMP] = operation{
+		execute:       opJump,
+		gasCost:       constGasCost(GckMid),
+		validateStack: minStack(1, 0),
+		jumps:         true,
+		valid:         true,
+	}
+	jt[JUMPI] = operation{
+		execute:       opJumpi,
+		gasCost:       constGasCost(GckHigh),
+		validateStack: minStack(2, 0),
+		jumps:         true,
+		valid:         true,
+	}
+	jt[RETURN] = operation{
+		execute:       opReturn,
+		gasCost:       dynamicGasCost(GckZero, gasReturn),
+		memorySize:    memoryReturn,
+		validateStack: minStack(2, 0),
+		halts:         true,
+		valid:         true,
+	}
+	jt[REVERT] = operation{
+		execute:       opRevert,
+		gasCost:       dynamicGasCost(GckZero, gasReturn),
+		memorySize:    memoryReturn,
+		validateStack: minStack(2, 0),
+		halts:         true,
+		reverts:       true,
+		valid:         isECIP1045B,
+	}
+	jt[RETURNDATACOPY] = operation{
+		// execute is filled in by New once the EVM exists: opReturnDataCopy
+		// is a method, bound to the EVM that owns the intPool its bounds
+		// check allocates out of.
+		gasCost:       dynamicGasCost(GckVeryLow, gasCopy(GasFastestStep)),
+		memorySize:    memoryOffsetSize3,
+		validateStack: minStack(3, 0),
+		valid:         isECIP1045B,
+	}
+	jt[SUICIDE] = operation{
+		execute:       opSuicide,
+		gasCost:       dynamicGasCost(GckAccount, gasSuicide),
+		validateStack: minStack(1, 0),
+		halts:         true,
+		writes:        true,
+		valid:         true,
+	}
+	jt[SSTORE] = operation{
+		execute:       opSstore,
+		gasCost:       dynamicGasCost(GckSStore, gasSStoreLegacy),
+		validateStack: minStack(2, 0),
+		writes:        true,
+		valid:         true,
+	}
+	jt[SLOAD] = operation{
+		execute:       opSload,
+		gasCost:       dynamicGasCost(GckAccount, gasSLoad),
+		validateStack: minStack(1, 1),
+		valid:         true,
+	}
+	jt[BALANCE] = operation{
+		execute:       opBalance,
+		gasCost:       dynamicGasCost(GckAccount, gasBalance),
+		validateStack: minStack(1, 1),
+		valid:         true,
+	}
+	jt[EXTCODESIZE] = operation{
+		execute:       opExtCodeSize,
+		gasCost:       dynamicGasCost(GckAccount, gasExtCodeSize),
+		validateStack: minStack(1, 1),
+		valid:         true,
+	}
+	jt[EXTCODECOPY] = operation{
+		execute:       opExtCodeCopy,
+		gasCost:       dynamicGasCost(GckCopy, gasExtCodeCopy),
+		memorySize:    memoryExtCodeCopy,
+		validateStack: minStack(4, 0),
+		valid:         true,
+	}
+	jt[CALLDATACOPY] = operation{
+		execute:       opCallDataCopy,
+		gasCost:       dynamicGasCost(GckVeryLow, gasCopy(GasFastestStep)),
+		memorySize:    memoryOffsetSize3,
+		validateStack: minStack(3, 0),
+		valid:         true,
+	}
+	jt[CODECOPY] = operation{
+		execute:       opCodeCopy,
+		gasCost:       dynamicGasCost(GckVeryLow, gasCopy(GasFastestStep)),
+		memorySize:    memoryOffsetSize3,
+		validateStack: minStack(3, 0),
+		valid:         true,
+	}
+	jt[MLOAD] = operation{
+		execute:       opMload,
+		gasCost:       dynamicGasCost(GckMemory, gasQuadMemory),
+		memorySize:    memoryMLoad,
+		validateStack: minStack(1, 1),
+		valid:         true,
+	}
+	jt[MSTORE] = operation{
+		execute:       opMstore,
+		gasCost:       dynamicGasCost(GckMemory, gasQuadMemory),
+		memorySize:    memoryMStore,
+		validateStack: minStack(2, 0),
+		valid:         true,
+	}
+	jt[MSTORE8] = operation{
+		execute:       opMstore8,
+		gasCost:       dynamicGasCost(GckMemory, gasQuadMemory),
+		memorySize:    memoryMStore8,
+		validateStack: minStack(2, 0),
+		valid:         true,
+	}
+	jt[SHA3] = operation{
+		execute:       opSha3,
+		gasCost:       dynamicGasCost(GckSha3, gasSha3),
+		memorySize:    memoryOffsetSize2,
+		validateStack: minStack(2, 1),
+		valid:         true,
+	}
+	jt[EXP] = operation{
+		execute:       opExp,
+		gasCost:       dynamicGasCost(GckExp, gasExp),
+		validateStack: minStack(2, 1),
+		valid:         true,
+	}
+	jt[CREATE] = operation{
+		execute:       opCreate,
+		gasCost:       dynamicGasCost(GckZero, gasCreate),
+		memorySize:    memoryCreate,
+		validateStack: minStack(3, 1),
+		writes:        true,
+		returns:       true,
+		valid:         true,
+	}
+	jt[CREATE2] = operation{
+		execute:       opCreate2,
+		gasCost:       dynamicGasCost(GckZero, gasCreate),
+		memorySize:    memoryCreate,
+		validateStack: minStack(4, 1),
+		writes:        true,
+		returns:       true,
+		valid:         isECIP1045B,
+	}
+	jt[CALL] = operation{
+		execute:       opCall,
+		gasCost:       constGasCost(GckCall),
+		memorySize:    memoryCall,
+		validateStack: minStack(7, 1),
+		// writes is left false here on purpose: vm.go's read-only guard
+		// already special-cases CALL by checking its value argument
+		// directly, since a zero-value CALL doesn't modify state and
+		// must still be allowed inside a STATICCALL frame.
+		returns: true,
+		valid:   true,
+	}
+	jt[CALLCODE] = operation{
+		execute:       opCallCode,
+		gasCost:       constGasCost(GckCall),
+		memorySize:    memoryCall,
+		validateStack: minStack(7, 1),
+		returns:       true,
+		valid:         true,
+	}
+	jt[DELEGATECALL] = operation{
+		execute:       opDelegateCall,
+		gasCost:       constGasCost(GckCall),
+		memorySize:    memoryDelegateCall,
+		validateStack: minStack(6, 1),
+		returns:       true,
+		valid:         isHomestead,
+	}
+	jt[STATICCALL] = operation{
+		execute:       opStaticCall,
+		gasCost:       constGasCost(GckCall),
+		memorySize:    memoryDelegateCall,
+		validateStack: minStack(6, 1),
+		returns:       true,
+		valid:         isECIP1045B,
+	}
+	for i := byte(LOG0); i <= byte(LOG4); i++ {
+		n := int(OpCode(i) - LOG0)
+		jt[i] = operation{
+			execute:       opLog(n),
+			gasCost:       dynamicGasCost(GckLog, gasLog(n)),
+			memorySize:    memoryOffsetSize2,
+			validateStack: minStack(n+2, 0),
+			writes:        true,
+			valid:         true,
+		}
+	}
+	for i := byte(DUP1); i <= byte(DUP16); i++ {
+		n := int(OpCode(i) - DUP1 + 1)
+		jt[i] = operation{
+			execute:       opDup(n),
+			gasCost:       constGasCost(GckVeryLow),
+			validateStack: minStack(n, n+1),
+			valid:         true,
+		}
+	}
+	for i := byte(SWAP1); i <= byte(SWAP16); i++ {
+		n := int(OpCode(i) - SWAP1 + 2)
+		jt[i] = operation{
+			execute:       opSwap(n),
+			gasCost:       constGasCost(GckVeryLow),
+			validateStack: minStack(n, n),
+			valid:         true,
+		}
+	}
+
+	// PC, RETURNDATACOPY, the arithmetic/comparison/bitwise opcodes and
+	// PUSH1-PUSH32's execute, the CALL family's gas cost, and SSTORE's
+	// EIP1283 variant all need evm.intPool or the EVM's Gasometer, so New
+	// overrides those entries once the EVM instance exists rather than here.
+
+	return jt
+}
+
+// minStack returns a stackValidationFunc requiring at least pop items on
+// the stack, and rejecting the opcode if executing it would leave more than
+// stackLimit items behind (it pops pop items and pushes push back).
+func minStack(pop, push int) stackValidationFunc {
+	return func(stack *stack) error {
+		if err := stack.require(pop); err != nil {
+			return err
+		}
+		if stack.len()+push-pop > stackLimit {
+			return errStackOverflow
+		}
+		return nil
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+	"testing"
+)
+
+// TestMinStackUnderflow checks that minStack still rejects a stack with
+// fewer than pop items on it, the same shortfall baseCheck used to catch.
+func TestMinStackUnderflow(t *testing.T) {
+	validate := minStack(2, 1)
+	s := newstack()
+	s.push(big.NewInt(1))
+
+	if err := validate(s); err == nil {
+		t.Fatalf("expected an underflow error popping 2 items off a 1-item stack")
+	}
+}
+
+// TestMinStackOverflow checks that minStack rejects an opcode that would
+// leave more than stackLimit items behind, even though it has enough items
+// to pop in the first place -- the check minStack dropped when it ignored
+// push.
+func TestMinStackOverflow(t *testing.T) {
+	validate := minStack(0, 1)
+	s := newstack()
+	for i := 0; i < stackLimit; i++ {
+		s.push(big.NewInt(int64(i)))
+	}
+
+	if err := validate(s); err != errStackOverflow {
+		t.Fatalf("err = %v, want errStackOverflow", err)
+	}
+}
+
+// TestMinStackNetZeroAtLimit checks that an opcode which pops as many items
+// as it pushes is still allowed to run with a full stack, since it leaves
+// the depth unchanged.
+func TestMinStackNetZeroAtLimit(t *testing.T) {
+	validate := minStack(2, 2)
+	s := newstack()
+	for i := 0; i < stackLimit; i++ {
+		s.push(big.NewInt(int64(i)))
+	}
+
+	if err := validate(s); err != nil {
+		t.Fatalf("unexpected error at a net-zero stack depth change: %v", err)
+	}
+}
+
+// fakeRuleSet is a minimal RuleSet stub letting newJumpTable's tests flip
+// individual forks on and off without pulling in a real chain config.
+type fakeRuleSet struct {
+	homestead, ecip1045b bool
+}
+
+func (r fakeRuleSet) IsHomestead(*big.Int) bool   { return r.homestead }
+func (r fakeRuleSet) IsEIP1283(*big.Int) bool     { return false }
+func (r fakeRuleSet) IsECIP1045B(*big.Int) bool   { return r.ecip1045b }
+func (r fakeRuleSet) GasTable(*big.Int) *GasTable { return &GasTable{} }
+
+// TestJumpTableOpcodesValid spot-checks that newJumpTable installs every
+// opcode category the migration was supposed to cover -- arithmetic,
+// comparison, bitwise, push and environment opcodes -- rather than only the
+// gas/memory-affected ones. All of these date from Frontier, so they must be
+// valid regardless of which forks are active.
+func TestJumpTableOpcodesValid(t *testing.T) {
+	jt := newJumpTable(fakeRuleSet{}, big.NewInt(0))
+
+	opcodes := []OpCode{
+		ADD, MUL, SUB, DIV, SDIV, MOD, SMOD, ADDMOD, MULMOD, SIGNEXTEND,
+		LT, GT, SLT, SGT, EQ, ISZERO,
+		AND, OR, XOR, NOT, BYTE,
+		ADDRESS, ORIGIN, CALLER, CALLVALUE, CALLDATALOAD, CALLDATASIZE,
+		CODESIZE, GASPRICE, POP, MSIZE, GAS, JUMPDEST,
+		PUSH1, PUSH32,
+	}
+	for _, op := range opcodes {
+		if !jt[op].valid {
+			t.Errorf("opcode %v was not installed into the jump table", op)
+		}
+	}
+}
+
+// TestJumpTableForkGating checks that opcodes introduced by a later fork are
+// rejected as invalid until that fork's ruleset check reports active, and
+// installed once it does -- a pre-fork block containing e.g. STATICCALL
+// must abort with "invalid opcode" rather than silently executing it.
+func TestJumpTableForkGating(t *testing.T) {
+	tests := []struct {
+		op                   OpCode
+		homestead, ecip1045b bool
+	}{
+		{DELEGATECALL, false, false},
+		{REVERT, false, false},
+		{RETURNDATACOPY, false, false},
+		{RETURNDATASIZE, false, false},
+		{STATICCALL, false, false},
+		{CREATE2, false, false},
+	}
+	for _, tt := range tests {
+		jt := newJumpTable(fakeRuleSet{}, big.NewInt(0))
+		if jt[tt.op].valid {
+			t.Errorf("%v should not be valid before its fork activates", tt.op)
+		}
+	}
+
+	active := newJumpTable(fakeRuleSet{homestead: true, ecip1045b: true}, big.NewInt(0))
+	for _, tt := range tests {
+		if !active[tt.op].valid {
+			t.Errorf("%v should be valid once its fork is active", tt.op)
+		}
+	}
+}
+
+// fullStack returns a stack already holding n arbitrary items, for probing
+// a stackValidationFunc's pop/push requirements without caring about the
+// values themselves.
+func fullStack(n int) *stack {
+	s := newstack()
+	for i := 0; i < n; i++ {
+		s.push(big.NewInt(0))
+	}
+	return s
+}
+
+// TestJumpTableGasAndStackGolden pins the (gas category, stack pop count,
+// stack push count) triple for one opcode out of each flat-priced gas
+// category, so a future repricing or stack-depth change shows up as a
+// failing test instead of silently changing consensus. The old inline
+// switch these opcodes used to live in is gone, so there's no "old path"
+// left to diff against directly; this is the closest thing to that parity
+// check that's still possible -- a fixed expectation per category, checked
+// against the real jump table entries rather than against minStack in the
+// abstract (TestMinStackUnderflow and friends already cover that).
+func TestJumpTableGasAndStackGolden(t *testing.T) {
+	golden := []struct {
+		op        OpCode
+		category  gasCostCategory
+		pop, push int
+	}{
+		{STOP, GckZero, 0, 0},
+		{ADD, GckVeryLow, 2, 1},
+		{MUL, GckLow, 2, 1},
+		{ADDMOD, GckMid, 3, 1},
+		{JUMPI, GckHigh, 2, 0},
+		{JUMPDEST, GckJumpdest, 0, 0},
+		{BLOCKHASH, GckExt, 1, 1},
+		{ADDRESS, GckBase, 0, 1},
+		{POP, GckBase, 1, 0},
+	}
+
+	jt := newJumpTable(fakeRuleSet{homestead: true, ecip1045b: true}, big.NewInt(0))
+	for _, g := range golden {
+		op := jt[g.op]
+		if op.gasCost.Category != g.category {
+			t.Errorf("%v: gas category = %v, want %v", g.op, op.gasCost.Category, g.category)
+		}
+
+		if err := op.validateStack(fullStack(g.pop)); err != nil {
+			t.Errorf("%v: unexpected error with exactly %d items on the stack: %v", g.op, g.pop, err)
+		}
+		if g.pop > 0 {
+			if err := op.validateStack(fullStack(g.pop - 1)); err == nil {
+				t.Errorf("%v: expected an underflow error with %d items on the stack", g.op, g.pop-1)
+			}
+		}
+
+		if net := g.push - g.pop; net > 0 {
+			if err := op.validateStack(fullStack(stackLimit - net)); err != nil {
+				t.Errorf("%v: unexpected error at the stack-limit boundary: %v", g.op, err)
+			}
+			if err := op.validateStack(fullStack(stackLimit - net + 1)); err != errStackOverflow {
+				t.Errorf("%v: err = %v, want errStackOverflow one item past the boundary", g.op, err)
+			}
+		}
+	}
+}
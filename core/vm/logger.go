@@ -0,0 +1,77 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+
+	"github.com/ethereumproject/go-ethereum/common"
+)
+
+// StackSnapshot is the read-only view of the interpreter's evaluation stack
+// passed to a Tracer's CaptureState and CaptureFault. The interpreter's own
+// stack type is package-private, so external Tracer implementations -- the
+// whole point of this interface -- have no other way to even declare a
+// matching method signature. Data is the live backing slice, not a copy;
+// like *Memory, it must not be retained past the capture call, since the
+// very next opcode may mutate it in place.
+type StackSnapshot struct {
+	Data []*big.Int
+}
+
+// Tracer is notified of every step the interpreter takes while running a
+// contract, and of the call's start and end. Implementations back things
+// like debug_traceTransaction and differential fuzzers; none of the
+// capture methods may retain the *Memory or *StackSnapshot they're given,
+// since both are mutated in place on the very next opcode.
+type Tracer interface {
+	CaptureStart(from, to common.Address, call bool, input []byte, gas uint64, value *big.Int) error
+	CaptureState(env Environment, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *StackSnapshot, contract *Contract, depth int, err error) error
+	CaptureFault(env Environment, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *StackSnapshot, contract *Contract, depth int, err error) error
+	CaptureEnd(output []byte, gasUsed uint64, err error) error
+}
+
+// Config bundles the knobs that change how an EVM runs without changing
+// what it computes: whether it's traced, whether CALL-family opcodes are
+// allowed to recurse, whether gas is metered at all, and which jump table
+// backs it. The zero value is the default: untraced, recursive, metered,
+// ruleset-derived.
+type Config struct {
+	// Debug enables interpreter step logging; Tracer, if set, is notified
+	// only while Debug is also true.
+	Debug  bool
+	Tracer Tracer
+
+	// NoRecursion makes Run a noop for every call frame but the
+	// outermost, so CALL, CALLCODE, DELEGATECALL, STATICCALL and CREATE
+	// stop short of actually entering the callee. Useful for measuring a
+	// single frame's gas or tracing in isolation.
+	NoRecursion bool
+
+	// DisableGasMetering skips gas accounting for every opcode: no cost
+	// is computed, no gas is deducted. Intended for tooling (symbolic
+	// execution, fuzzing harnesses) that doesn't care about gas and would
+	// rather not have OutOfGasError cut a run short.
+	DisableGasMetering bool
+
+	// JumpTable, if non-nil, is used verbatim instead of the one New
+	// would otherwise derive from the active ruleset. This lets callers
+	// experiment with custom opcodes or repricing without forking the
+	// package. Build a starting point with NewJumpTable, since JumpTable
+	// itself is just [256]operation and operation's fields are private.
+	JumpTable *JumpTable
+}
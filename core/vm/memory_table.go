@@ -0,0 +1,119 @@
+// Copyright 2014 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import "math/big"
+
+// This file holds the memorySizeFuncs that used to be computed inline in
+// calculateGasAndSize. Each one reports the memory size (in bytes) an
+// opcode needs before it can be charged and executed, or ErrGasUintOverflow
+// if the stack arguments describe an offset no real machine could back.
+
+// memoryOffsetSize2 covers opcodes whose memory offset is the top stack
+// item and whose length is the second item: RETURN, REVERT, LOG*, SHA3.
+func memoryOffsetSize2(stack *stack) (uint64, error) {
+	size, overflow := calcMemSize(stack.peek(), stack.data[stack.len()-2])
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+	return size, nil
+}
+
+// memoryOffsetSize3 covers opcodes whose memory offset is the top stack
+// item and whose length is the third item: CALLDATACOPY, CODECOPY,
+// RETURNDATACOPY.
+func memoryOffsetSize3(stack *stack) (uint64, error) {
+	size, overflow := calcMemSize(stack.peek(), stack.data[stack.len()-3])
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+	return size, nil
+}
+
+func memoryReturn(stack *stack) (uint64, error) {
+	return memoryOffsetSize2(stack)
+}
+
+func memoryMLoad(stack *stack) (uint64, error) {
+	size, overflow := calcMemSize(stack.peek(), big.NewInt(32))
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+	return size, nil
+}
+
+func memoryMStore8(stack *stack) (uint64, error) {
+	size, overflow := calcMemSize(stack.peek(), big.NewInt(1))
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+	return size, nil
+}
+
+func memoryMStore(stack *stack) (uint64, error) {
+	size, overflow := calcMemSize(stack.peek(), big.NewInt(32))
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+	return size, nil
+}
+
+func memoryExtCodeCopy(stack *stack) (uint64, error) {
+	size, overflow := calcMemSize(stack.data[stack.len()-2], stack.data[stack.len()-4])
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+	return size, nil
+}
+
+func memoryCreate(stack *stack) (uint64, error) {
+	size, overflow := calcMemSize(stack.data[stack.len()-2], stack.data[stack.len()-3])
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+	return size, nil
+}
+
+func memoryCall(stack *stack) (uint64, error) {
+	x, overflow := calcMemSize(stack.data[stack.len()-6], stack.data[stack.len()-7])
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+	y, overflow := calcMemSize(stack.data[stack.len()-4], stack.data[stack.len()-5])
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+	if x > y {
+		return x, nil
+	}
+	return y, nil
+}
+
+func memoryDelegateCall(stack *stack) (uint64, error) {
+	x, overflow := calcMemSize(stack.data[stack.len()-5], stack.data[stack.len()-6])
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+	y, overflow := calcMemSize(stack.data[stack.len()-3], stack.data[stack.len()-4])
+	if overflow {
+		return 0, ErrGasUintOverflow
+	}
+	if x > y {
+		return x, nil
+	}
+	return y, nil
+}
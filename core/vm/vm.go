@@ -44,26 +44,103 @@ type VirtualMachine interface {
 // configuration.
 type EVM struct {
 	env       Environment
-	jumpTable vmJumpTable
-	gasTable  GasTable
+	jumpTable JumpTable
+
+	// gasometer prices and charges for every opcode executed; see its own
+	// doc comment for why that's no longer done inline in the jump table.
+	gasometer *Gasometer
+
+	// intPool recycles the *big.Int values opcode execution and gas
+	// calculation allocate, to keep deep call traces from generating as
+	// much garbage.
+	intPool *intPool
+
+	cfg Config
 }
 
-// New returns a new instance of the EVM.
-func New(env Environment) *EVM {
-	return &EVM{
+// New returns a new instance of the EVM. A zero-value Config runs exactly
+// as before New took one: untraced, recursive, metered, ruleset-derived.
+func New(env Environment, cfg Config) *EVM {
+	evm := &EVM{
 		env:       env,
-		jumpTable: newJumpTable(env.RuleSet(), env.BlockNumber()),
-		gasTable:  *env.RuleSet().GasTable(env.BlockNumber()),
+		gasometer: newGasometer(env.RuleSet().GasTable(env.BlockNumber())),
+		intPool:   newIntPool(),
+		cfg:       cfg,
+	}
+
+	// A caller-supplied JumpTable is used exactly as given; it bypasses
+	// both the ruleset-derived table below and the per-EVM method
+	// overrides that table would otherwise receive.
+	if cfg.JumpTable != nil {
+		evm.jumpTable = *cfg.JumpTable
+		return evm
 	}
+
+	evm.jumpTable = newJumpTable(env.RuleSet(), env.BlockNumber())
+	// PC, RETURNDATACOPY, PUSH1-PUSH32 and the arithmetic/comparison/bitwise
+	// opcodes below reuse big.Int storage out of evm.intPool, so they're bound as
+	// methods and installed after the EVM exists. The CALL-family gas costs
+	// do the same, to recycle the stack slot they rewrite with the gas
+	// actually forwarded to the callee.
+	evm.jumpTable[PC].execute = evm.opPc
+	evm.jumpTable[RETURNDATACOPY].execute = evm.opReturnDataCopy
+	evm.jumpTable[ADD].execute = evm.opAdd
+	evm.jumpTable[MUL].execute = evm.opMul
+	evm.jumpTable[SUB].execute = evm.opSub
+	evm.jumpTable[DIV].execute = evm.opDiv
+	evm.jumpTable[SDIV].execute = evm.opSdiv
+	evm.jumpTable[MOD].execute = evm.opMod
+	evm.jumpTable[SMOD].execute = evm.opSmod
+	evm.jumpTable[ADDMOD].execute = evm.opAddmod
+	evm.jumpTable[MULMOD].execute = evm.opMulmod
+	evm.jumpTable[LT].execute = evm.opLt
+	evm.jumpTable[GT].execute = evm.opGt
+	evm.jumpTable[SLT].execute = evm.opSlt
+	evm.jumpTable[SGT].execute = evm.opSgt
+	evm.jumpTable[EQ].execute = evm.opEq
+	evm.jumpTable[ISZERO].execute = evm.opIszero
+	evm.jumpTable[AND].execute = evm.opAnd
+	evm.jumpTable[OR].execute = evm.opOr
+	evm.jumpTable[XOR].execute = evm.opXor
+	evm.jumpTable[BYTE].execute = evm.opByte
+	for i := byte(PUSH1); i <= byte(PUSH32); i++ {
+		n := int(OpCode(i) - PUSH1 + 1)
+		evm.jumpTable[i].execute = evm.makePush(uint64(n), n)
+	}
+	evm.jumpTable[CALL].gasCost.Dynamic = evm.gasCallDynamic
+	evm.jumpTable[CALLCODE].gasCost.Dynamic = evm.gasCallCodeDynamic
+	evm.jumpTable[DELEGATECALL].gasCost.Dynamic = evm.gasDelegateCallDynamic
+	evm.jumpTable[STATICCALL].gasCost.Dynamic = evm.gasDelegateCallDynamic
+	if env.RuleSet().IsEIP1283(env.BlockNumber()) {
+		evm.jumpTable[SSTORE].gasCost.Dynamic = evm.gasSStoreEIP1283Dynamic
+	}
+	return evm
 }
 
 // Run loops and evaluates the contract's code with the given input data
 func (evm *EVM) Run(contract *Contract, input []byte) (ret []byte, err error) {
+	// A non-zero depth means this call is itself the result of a CALL,
+	// CALLCODE, DELEGATECALL, STATICCALL or CREATE opcode entering its
+	// callee: under NoRecursion that's where execution stops.
+	if evm.cfg.NoRecursion && evm.env.Depth() > 0 {
+		return nil, nil
+	}
+
 	evm.env.SetDepth(evm.env.Depth() + 1)
 	defer evm.env.SetDepth(evm.env.Depth() - 1)
 
 	evm.env.SetReturnData(nil)
 
+	if evm.cfg.Debug && evm.cfg.Tracer != nil {
+		startGas := contract.Gas
+		if err := evm.cfg.Tracer.CaptureStart(contract.Caller(), contract.Address(), contract.CodeAddr != nil, input, startGas, contract.Value()); err != nil {
+			return nil, err
+		}
+		defer func() {
+			evm.cfg.Tracer.CaptureEnd(ret, startGas-contract.Gas, err)
+		}()
+	}
+
 	if contract.CodeAddr != nil {
 		precompiles := PrecompiledHomestead
 		if evm.env.RuleSet().IsECIP1045B(evm.env.BlockNumber()) {
@@ -83,36 +160,16 @@ func (evm *EVM) Run(contract *Contract, input []byte) (ret []byte, err error) {
 	if codehash == (common.Hash{}) {
 		codehash = crypto.Keccak256Hash(contract.Code)
 	}
+	contract.CodeHash = codehash
 
 	var (
-		caller            = contract.caller
-		code              = contract.Code
-		originalSStoreMap = make(map[common.Address]common.Hash) // stores "original" values from SSTORE if called, for use in computing EIP1283
-		instrCount        = 0
-
-		op      OpCode         // current opcode
-		mem     = NewMemory()  // bound memory
-		stack   = newstack()   // local stack
-		statedb = evm.env.Db() // current state
+		instrCount = 0
+
+		mem   = NewMemory() // bound memory
+		stack = newstack()  // local stack
 		// For optimisation reason we're using uint64 as the program counter.
 		// It's theoretically possible to go above 2^64. The YP defines the PC to be uint256. Practically much less so feasible.
 		pc = uint64(0) // program counter
-
-		// jump evaluates and checks whether the given jump destination is a valid one
-		// if valid move the `pc` otherwise return an error.
-		jump = func(from uint64, to *big.Int) error {
-			if !contract.jumpdests.has(codehash, code, to) {
-				nop := contract.GetOp(to.Uint64())
-				return fmt.Errorf("invalid jump destination (%v) %v", nop, to)
-			}
-
-			pc = to.Uint64()
-
-			return nil
-		}
-
-		newMemSize *big.Int
-		cost       *big.Int
 	)
 	contract.Input = input
 
@@ -125,8 +182,13 @@ func (evm *EVM) Run(contract *Contract, input []byte) (ret []byte, err error) {
 	}
 
 	for ; ; instrCount++ {
-		// Get the memory location of pc
-		op = contract.GetOp(pc)
+		// Get the operation at this pc and make sure it's valid.
+		op := contract.GetOp(pc)
+
+		operation := evm.jumpTable[op]
+		if !operation.valid {
+			return nil, fmt.Errorf("Invalid opcode %x", op)
+		}
 
 		// If the interpreter is operating in readonly mode, make sure no
 		// state-modifying operation is performed. The 3rd stack item
@@ -134,295 +196,78 @@ func (evm *EVM) Run(contract *Contract, input []byte) (ret []byte, err error) {
 		// account to the others means the state is modified and should also
 		// return with an error.
 		checkStateMod := evm.env.RuleSet().IsECIP1045B(evm.env.BlockNumber()) && evm.env.IsReadOnly()
-		checkStateMod = checkStateMod && (op.IsStateModifying() || op == CALL && stack.data[stack.len()-2-1].BitLen() > 0)
+		checkStateMod = checkStateMod && (operation.writes || op == CALL && stack.data[stack.len()-2-1].BitLen() > 0)
 		if checkStateMod {
 			return nil, errWriteProtection
 		}
-		// calculate the new memory size and gas price for the current executing opcode
-		newMemSize, cost, err = calculateGasAndSize(&evm.gasTable, evm.env, contract, caller, op, statedb, mem, stack, originalSStoreMap)
-		if err != nil {
-			return nil, err
-		}
 
-		// Use the calculated gas. When insufficient gas is present, use all gas and return an
-		// Out Of Gas error
-		if !contract.UseGas(cost) {
-			return nil, OutOfGasError
+		if err := operation.validateStack(stack); err != nil {
+			return nil, err
 		}
 
-		// Resize the memory calculated previously
-		mem.Resize(newMemSize.Uint64())
-
-		opPtr := evm.jumpTable[op]
-		if opPtr.valid {
-			if opPtr.fn != nil {
-				opPtr.fn(instruction{}, &pc, evm.env, contract, mem, stack)
-			} else {
-				switch op {
-				case PC:
-					opPc(instruction{data: new(big.Int).SetUint64(pc)}, &pc, evm.env, contract, mem, stack)
-				case JUMP:
-					if err := jump(pc, stack.pop()); err != nil {
-						return nil, err
-					}
-
-					continue
-				case JUMPI:
-					pos, cond := stack.pop(), stack.pop()
-
-					if cond.Sign() != 0 {
-						if err := jump(pc, pos); err != nil {
-							return nil, err
-						}
-
-						continue
-					}
-				case REVERT:
-					offset, size := stack.pop(), stack.pop()
-					ret := mem.GetPtr(offset.Int64(), size.Int64())
-
-					return ret, ErrExecutionReverted
-
-				case RETURN:
-					offset, size := stack.pop(), stack.pop()
-					ret := mem.GetPtr(offset.Int64(), size.Int64())
-
-					return ret, nil
-				case RETURNDATACOPY:
-					if _, err := opReturnDataCopy(instruction{}, &pc, evm.env, contract, mem, stack); err != nil {
-						return nil, err
-					}
-
-				case SUICIDE:
-					opSuicide(instruction{}, nil, evm.env, contract, mem, stack)
-
-					fallthrough
-				case STOP: // Stop the contract
-					return nil, nil
-				}
+		var memSize uint64
+		if operation.memorySize != nil {
+			if memSize, err = operation.memorySize(stack); err != nil {
+				return nil, err
 			}
-		} else {
-			return nil, fmt.Errorf("Invalid opcode %x", op)
 		}
 
-		if op.IsReturning() {
-			evm.env.SetReturnData(ret)
+		// gasRemaining is the gas available before this opcode's cost is
+		// deducted below -- what a Tracer means by "gas remaining at this
+		// step", as opposed to contract.Gas once Consume has already paid
+		// for it.
+		gasRemaining := contract.Gas
+
+		// Price and charge for the current opcode. When insufficient gas
+		// is present, the gasometer reports OutOfGasError. DisableGasMetering
+		// skips this entirely, for tooling that would rather not have a
+		// run cut short by it.
+		var cost uint64
+		if !evm.cfg.DisableGasMetering {
+			if cost, err = evm.gasometer.Consume(operation.gasCost, evm.env, contract, stack, mem, memSize); err != nil {
+				return nil, err
+			}
 		}
 
-		pc++
-	}
-}
-
-// calculateGasAndSize calculates the required given the opcode and stack items calculates the new memorysize for
-// the operation. This does not reduce gas or resizes the memory.
-func calculateGasAndSize(gasTable *GasTable, env Environment, contract *Contract, caller ContractRef, op OpCode, statedb Database, mem *Memory, stack *stack, originalSStoreMap map[common.Address]common.Hash) (*big.Int, *big.Int, error) {
-	var (
-		gas        = new(big.Int)
-		newMemSize = new(big.Int)
-	)
-	err := baseCheck(op, stack, gas)
-	if err != nil {
-		return nil, nil, err
-	}
+		// Resize the memory calculated previously.
+		mem.Resize(memSize)
 
-	// stack Check, memory resize & gas phase
-	switch op {
-	case SUICIDE:
-		// if suicide is not nil: homestead gas fork
-		if gasTable.CreateBySuicide != nil {
-			gas.Set(gasTable.Suicide)
-			if !env.Db().Exist(common.BigToAddress(stack.data[len(stack.data)-1])) {
-				gas.Add(gas, gasTable.CreateBySuicide)
+		if evm.cfg.Debug && evm.cfg.Tracer != nil {
+			if err := evm.cfg.Tracer.CaptureState(evm.env, pc, op, gasRemaining, cost, mem, &StackSnapshot{Data: stack.data}, contract, evm.env.Depth(), nil); err != nil {
+				return nil, err
 			}
 		}
 
-		if !statedb.HasSuicided(contract.Address()) {
-			statedb.AddRefund(big.NewInt(24000))
-		}
-	case EXTCODESIZE:
-		gas.Set(gasTable.ExtcodeSize)
-	case BALANCE:
-		gas.Set(gasTable.Balance)
-	case SLOAD:
-		gas.Set(gasTable.SLoad)
-	case SWAP1, SWAP2, SWAP3, SWAP4, SWAP5, SWAP6, SWAP7, SWAP8, SWAP9, SWAP10, SWAP11, SWAP12, SWAP13, SWAP14, SWAP15, SWAP16:
-		n := int(op - SWAP1 + 2)
-		err := stack.require(n)
-		if err != nil {
-			return nil, nil, err
-		}
-		gas.Set(GasFastestStep)
-	case DUP1, DUP2, DUP3, DUP4, DUP5, DUP6, DUP7, DUP8, DUP9, DUP10, DUP11, DUP12, DUP13, DUP14, DUP15, DUP16:
-		n := int(op - DUP1 + 1)
-		err := stack.require(n)
+		res, err := operation.execute(&pc, evm.env, contract, mem, stack)
 		if err != nil {
-			return nil, nil, err
-		}
-		gas.Set(GasFastestStep)
-	case LOG0, LOG1, LOG2, LOG3, LOG4:
-		n := int(op - LOG0)
-		err := stack.require(n + 2)
-		if err != nil {
-			return nil, nil, err
-		}
-
-		mSize, mStart := stack.data[stack.len()-2], stack.data[stack.len()-1]
-
-		// log gas
-		gas.Add(gas, big.NewInt(375))
-		// log topic gass
-		gas.Add(gas, new(big.Int).Mul(big.NewInt(int64(n)), big.NewInt(375)))
-		// log data gass
-		gas.Add(gas, new(big.Int).Mul(mSize, big.NewInt(8)))
-
-		newMemSize = calcMemSize(mStart, mSize)
-
-		quadMemGas(mem, newMemSize, gas)
-	case EXP:
-		expByteLen := int64(len(stack.data[stack.len()-2].Bytes()))
-		gas.Add(gas, new(big.Int).Mul(big.NewInt(expByteLen), gasTable.ExpByte))
-	case SSTORE:
-		err := stack.require(2)
-		if err != nil {
-			return nil, nil, err
-		}
-
-		var g *big.Int
-		refundCounter := big.NewInt(0)
-		newValue, storageLoc := stack.data[stack.len()-2], stack.data[stack.len()-1]
-
-		currentValue := statedb.GetState(contract.Address(), common.BigToHash(storageLoc))
-
-		if !env.RuleSet().IsEIP1283(env.BlockNumber()) {
-			// Not-EIP1283
-			// This checks for 3 scenario's and calculates gas accordingly
-			// 1. From a zero-value address to a non-zero value         (NEW VALUE)
-			// 2. From a non-zero value address to a zero-value address (DELETE)
-			// 3. From a non-zero to a non-zero                         (CHANGE)
-			if common.EmptyHash(currentValue) && !common.EmptyHash(common.BigToHash(newValue)) {
-				// 0 => non 0
-				g = big.NewInt(20000) // Once per SLOAD operation.
-			} else if !common.EmptyHash(currentValue) && common.EmptyHash(common.BigToHash(newValue)) {
-				refundCounter.Add(refundCounter, big.NewInt(15000))
-				g = big.NewInt(5000)
-			} else {
-				// non 0 => non 0 (or 0 => 0)
-				g = big.NewInt(5000)
+			if evm.cfg.Debug && evm.cfg.Tracer != nil {
+				evm.cfg.Tracer.CaptureFault(evm.env, pc, op, gasRemaining, cost, mem, &StackSnapshot{Data: stack.data}, contract, evm.env.Depth(), err)
 			}
-		} else {
-			var originalValue common.Hash
-			loc := common.BigToAddress(storageLoc)
-			if v, ok := originalSStoreMap[loc]; ok {
-				originalValue = v
-			} else {
-				originalSStoreMap[loc] = currentValue
-				originalValue = currentValue
-			}
-			g, refundCounter = eip1283sstoreGas(originalValue.Big(), currentValue.Big(), newValue)
+			return nil, err
 		}
 
-		gas.Set(g)
-		statedb.AddRefund(refundCounter)
-
-	case MLOAD:
-		newMemSize = calcMemSize(stack.peek(), u256(32))
-		quadMemGas(mem, newMemSize, gas)
-	case MSTORE8:
-		newMemSize = calcMemSize(stack.peek(), u256(1))
-		quadMemGas(mem, newMemSize, gas)
-	case MSTORE:
-		newMemSize = calcMemSize(stack.peek(), u256(32))
-		quadMemGas(mem, newMemSize, gas)
-	case RETURN, REVERT:
-		newMemSize = calcMemSize(stack.peek(), stack.data[stack.len()-2])
-		quadMemGas(mem, newMemSize, gas)
-	case SHA3:
-		newMemSize = calcMemSize(stack.peek(), stack.data[stack.len()-2])
-
-		words := toWordSize(stack.data[stack.len()-2])
-		gas.Add(gas, words.Mul(words, big.NewInt(6)))
-
-		quadMemGas(mem, newMemSize, gas)
-	case CALLDATACOPY, RETURNDATACOPY:
-		newMemSize = calcMemSize(stack.peek(), stack.data[stack.len()-3])
-
-		words := toWordSize(stack.data[stack.len()-3])
-		gas.Add(gas, words.Mul(words, big.NewInt(3)))
-
-		quadMemGas(mem, newMemSize, gas)
-	case CODECOPY:
-		newMemSize = calcMemSize(stack.peek(), stack.data[stack.len()-3])
-
-		words := toWordSize(stack.data[stack.len()-3])
-		gas.Add(gas, words.Mul(words, big.NewInt(3)))
-
-		quadMemGas(mem, newMemSize, gas)
-	case EXTCODECOPY:
-		gas.Set(gasTable.ExtcodeCopy)
-
-		newMemSize = calcMemSize(stack.data[stack.len()-2], stack.data[stack.len()-4])
-
-		words := toWordSize(stack.data[stack.len()-4])
-		gas.Add(gas, words.Mul(words, big.NewInt(3)))
-
-		quadMemGas(mem, newMemSize, gas)
-	case CREATE, CREATE2:
-		newMemSize = calcMemSize(stack.data[stack.len()-2], stack.data[stack.len()-3])
-
-		quadMemGas(mem, newMemSize, gas)
-	case CALL, CALLCODE:
-		gas.Set(gasTable.Calls)
-
-		if op == CALL {
-			if !env.Db().Exist(common.BigToAddress(stack.data[stack.len()-2])) {
-				gas.Add(gas, big.NewInt(25000))
-			}
-		}
-		if len(stack.data[stack.len()-3].Bytes()) > 0 {
-			gas.Add(gas, big.NewInt(9000))
+		switch {
+		case operation.reverts:
+			return res, ErrExecutionReverted
+		case operation.halts:
+			return res, nil
+		case operation.jumps:
+			continue
 		}
-		x := calcMemSize(stack.data[stack.len()-6], stack.data[stack.len()-7])
-		y := calcMemSize(stack.data[stack.len()-4], stack.data[stack.len()-5])
 
-		newMemSize = common.BigMax(x, y)
-
-		quadMemGas(mem, newMemSize, gas)
-
-		cg := callGas(gasTable, contract.Gas, gas, stack.data[stack.len()-1])
-		// Replace the stack item with the new gas calculation. This means that
-		// either the original item is left on the stack or the item is replaced by:
-		// (availableGas - gas) * 63 / 64
-		// We replace the stack item so that it's available when the opCall instruction is
-		// called. This information is otherwise lost due to the dependency on *current*
-		// available gas.
-		stack.data[stack.len()-1] = cg
-		gas.Add(gas, cg)
-
-	case DELEGATECALL, STATICCALL:
-		gas.Set(gasTable.Calls)
-
-		x := calcMemSize(stack.data[stack.len()-5], stack.data[stack.len()-6])
-		y := calcMemSize(stack.data[stack.len()-3], stack.data[stack.len()-4])
-
-		newMemSize = common.BigMax(x, y)
-
-		quadMemGas(mem, newMemSize, gas)
-
-		cg := callGas(gasTable, contract.Gas, gas, stack.data[stack.len()-1])
-		// Replace the stack item with the new gas calculation. This means that
-		// either the original item is left on the stack or the item is replaced by:
-		// (availableGas - gas) * 63 / 64
-		// We replace the stack item so that it's available when the opCall instruction is
-		// called.
-		stack.data[stack.len()-1] = cg
-		gas.Add(gas, cg)
+		if operation.returns {
+			evm.env.SetReturnData(res)
+		}
 
+		pc++
 	}
-
-	return newMemSize, gas, nil
 }
 
-// RunPrecompile runs and evaluate the output of a precompiled contract defined in contracts.go
+// RunPrecompile runs and evaluate the output of a precompiled contract
+// defined in contracts.go. Like the rest of this series' gas path
+// (Gasometer.Consume, contract.UseGas), p.Gas must report its cost as a
+// uint64, not a *big.Int -- gas never exceeds a block's gas limit, so
+// there's no reason for either side of this call to allocate.
 func RunPrecompiled(p *PrecompiledAccount, input []byte, contract *Contract) (ret []byte, err error) {
 	gas := p.Gas(input)
 	if contract.UseGas(gas) {
@@ -431,56 +276,3 @@ func RunPrecompiled(p *PrecompiledAccount, input []byte, contract *Contract) (re
 		return nil, OutOfGasError
 	}
 }
-
-func eip1283sstoreGas(originalValue, currentValue, newValue *big.Int) (g, refundCounter *big.Int) {
-	refundCounter = big.NewInt(0)
-	// EIP1283
-	// Set singleton original store value if SSTORE hasn't yet been called, or set local value if it has already been called.
-	// PTAL: It seems devastatingly ironic that I'm now using a "dirty storage map" to keep track of original values.
-
-	// EIP1283
-	// If current value equals new value (noop), 200 gas deducted
-	if newValue.Cmp(currentValue) == 0 {
-		g = big.NewInt(200)
-	} else {
-		// If current value != new value
-		// If original value equals current value (this storage slot has not been changed by the current execution context)
-		// If original value is 0, 20000 gas is deducted.
-		// 	Otherwise, 5000 gas is deducted. If new value is 0, add 15000 gas to refund counter.
-		if originalValue.Cmp(currentValue) == 0 {
-			if originalValue.Cmp(common.Big0) == 0 {
-				g = big.NewInt(20000)
-			} else {
-				g = big.NewInt(5000)
-				if newValue.Cmp(common.Big0) == 0 {
-					refundCounter.Add(refundCounter, big.NewInt(15000))
-				}
-			}
-		} else {
-			// If original value does not equal current value (this storage slot is dirty), 200 gas is deducted. Apply both of the following clauses.
-			g = big.NewInt(200)
-			// 1. If original value is not 0
-			// If current value is 0 (also means that new value is not 0), remove 15000 gas from refund counter. We can prove that refund counter will never go below 0.
-			// If new value is 0 (also means that current value is not 0), add 15000 gas to refund counter.
-			if originalValue.Cmp(common.Big0) != 0 {
-				if currentValue.Cmp(common.Big0) == 0 {
-					refundCounter.Sub(refundCounter, big.NewInt(15000))
-				}
-				if newValue.Cmp(common.Big0) == 0 {
-					refundCounter.Add(refundCounter, big.NewInt(15000))
-				}
-			}
-			// 2. If original value equals new value (this storage slot is reset)
-			// If original value is 0, add 19800 gas to refund counter.
-			// Otherwise, add 4800 gas to refund counter.
-			if originalValue.Cmp(newValue) == 0 {
-				if originalValue.Cmp(common.Big0) == 0 {
-					refundCounter.Add(refundCounter, big.NewInt(19800))
-				} else {
-					refundCounter.Add(refundCounter, big.NewInt(4800))
-				}
-			}
-		}
-	}
-	return
-}